@@ -0,0 +1,367 @@
+package controller
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RoadieHQ/kubewise/kwrelease"
+	"github.com/RoadieHQ/kubewise/utils"
+	"helm.sh/helm/v3/pkg/chart"
+	rspb "helm.sh/helm/v3/pkg/release"
+	api_v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const defaultCheckpointConfigMapName = "kubewise-checkpoint"
+
+// Writing the ConfigMap for every event would make the workers take turns behind an API
+// request. Instead, changes are written at most this often, and when KubeWise shuts down.
+const defaultCheckpointFlushInterval = 5 * time.Second
+
+// checkpointEntry is the last revision of a release which KubeWise notified the user about.
+// It holds enough detail to describe the release if it is uninstalled while KubeWise is down.
+type checkpointEntry struct {
+	Name         string `json:"name"`
+	Namespace    string `json:"namespace"`
+	Revision     int    `json:"revision"`
+	Status       string `json:"status"`
+	ChartName    string `json:"chartName"`
+	ChartVersion string `json:"chartVersion"`
+	AppVersion   string `json:"appVersion"`
+}
+
+// checkpoint persists the last notified revision of every release in a ConfigMap. It allows
+// KubeWise to catch up on Helm operations which happened while it was not running.
+//
+// Changes are flushed to the ConfigMap periodically. If KubeWise is killed before a flush, the
+// notifications since the last flush are sent again when it restarts.
+type checkpoint struct {
+	// cluster is the cluster whose releases are checkpointed. clientset is for the cluster which
+	// KubeWise runs in, where the ConfigMap is kept.
+	cluster       *utils.Cluster
+	clientset     kubernetes.Interface
+	namespace     string
+	name          string
+	flushInterval time.Duration
+	mutex         sync.Mutex
+	entries       map[string]*checkpointEntry
+	// dirty is set when entries has changed since it was last saved.
+	dirty bool
+	// flushMutex stops two flushes from writing the ConfigMap at the same time.
+	flushMutex sync.Mutex
+	running    sync.WaitGroup
+}
+
+func isCheckpointEnabled() bool {
+	return utils.GetEnvBool("KW_CHECKPOINT_ENABLED", false)
+}
+
+// newCheckpoint creates the checkpoint for a cluster. Each cluster which KubeWise watches,
+// other than the one it runs in, is checkpointed in a ConfigMap of its own.
+func newCheckpoint(client kubernetes.Interface, cluster *utils.Cluster) *checkpoint {
+	name := defaultCheckpointConfigMapName
+	if value, ok := os.LookupEnv("KW_CHECKPOINT_CONFIGMAP"); ok && value != "" {
+		name = value
+	}
+	if !cluster.Local {
+		name += "-" + sanitizeObjectName(cluster.Name)
+	}
+
+	return &checkpoint{
+		cluster:       cluster,
+		clientset:     client,
+		namespace:     utils.GetPodNamespace(),
+		name:          name,
+		flushInterval: utils.GetEnvDuration("KW_CHECKPOINT_FLUSH_INTERVAL", defaultCheckpointFlushInterval),
+		entries:       make(map[string]*checkpointEntry),
+	}
+}
+
+// Kubeconfig context names, such as those created for EKS clusters, often contain characters
+// which are not allowed in the name of a Kubernetes object.
+var invalidObjectNameCharacters = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+func sanitizeObjectName(name string) string {
+	return strings.Trim(invalidObjectNameCharacters.ReplaceAllString(strings.ToLower(name), "-"), "-.")
+}
+
+// ConfigMap keys may only contain alphanumerics, '-', '_' and '.'. Neither release names nor
+// namespaces may contain an underscore so it makes an unambiguous separator.
+func checkpointKey(namespace string, name string) string {
+	return namespace + "_" + name
+}
+
+// load reads the checkpoint from the cluster. It reports false if no checkpoint has been
+// saved yet, which is the case the first time KubeWise runs.
+func (cp *checkpoint) load() (bool, error) {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+
+	configMap, err := cp.clientset.CoreV1().ConfigMaps(cp.namespace).Get(cp.name, meta_v1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	for key, value := range configMap.Data {
+		entry := &checkpointEntry{}
+		if err := json.Unmarshal([]byte(value), entry); err != nil {
+			log.Println("Ignoring malformed checkpoint entry:", key)
+			continue
+		}
+		cp.entries[key] = entry
+	}
+
+	return true, nil
+}
+
+// snapshot encodes every entry as ConfigMap data. The caller must hold the mutex.
+func (cp *checkpoint) snapshot() (map[string]string, error) {
+	data := make(map[string]string, len(cp.entries))
+	for key, entry := range cp.entries {
+		value, err := json.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+		data[key] = string(value)
+	}
+	return data, nil
+}
+
+// save writes every entry to the ConfigMap. The caller must hold the mutex.
+func (cp *checkpoint) save() error {
+	data, err := cp.snapshot()
+	if err != nil {
+		return err
+	}
+	if err := cp.write(data); err != nil {
+		return err
+	}
+	cp.dirty = false
+	return nil
+}
+
+// write replaces the data in the ConfigMap, creating it if necessary.
+func (cp *checkpoint) write(data map[string]string) error {
+	configMaps := cp.clientset.CoreV1().ConfigMaps(cp.namespace)
+	configMap, err := configMaps.Get(cp.name, meta_v1.GetOptions{})
+
+	if errors.IsNotFound(err) {
+		_, err = configMaps.Create(&api_v1.ConfigMap{
+			ObjectMeta: meta_v1.ObjectMeta{
+				Name:      cp.name,
+				Namespace: cp.namespace,
+			},
+			Data: data,
+		})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	configMap.Data = data
+	_, err = configMaps.Update(configMap)
+	return err
+}
+
+// record stores the release in a handled event as the last one the user was notified about.
+// It is saved by the next flush.
+func (cp *checkpoint) record(releaseEvent *kwrelease.Event) {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+
+	key := checkpointKey(releaseEvent.GetNamespace(), releaseEvent.GetAppName())
+
+	if releaseEvent.GetAction() == kwrelease.ActionPostUninstall {
+		delete(cp.entries, key)
+	} else {
+		cp.entries[key] = &checkpointEntry{
+			Name:         releaseEvent.GetAppName(),
+			Namespace:    releaseEvent.GetNamespace(),
+			Revision:     releaseEvent.GetRevision(),
+			Status:       releaseEvent.GetStatus().String(),
+			ChartName:    releaseEvent.GetChartName(),
+			ChartVersion: releaseEvent.GetChartVersion(),
+			AppVersion:   releaseEvent.GetAppVersion(),
+		}
+	}
+	cp.dirty = true
+}
+
+// start flushes the checkpoint every flushInterval until stopCh is closed.
+func (cp *checkpoint) start(stopCh <-chan struct{}) {
+	cp.running.Add(1)
+	go func() {
+		defer cp.running.Done()
+
+		ticker := time.NewTicker(cp.flushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				cp.flush()
+			}
+		}
+	}()
+}
+
+// stop waits for a flush which is underway and then saves any remaining changes. It must only
+// be called once stopCh has been closed and the workers have stopped.
+func (cp *checkpoint) stop() {
+	cp.running.Wait()
+	cp.flush()
+}
+
+// flush saves the checkpoint if it has changed. The ConfigMap is written without holding the
+// mutex so that workers can record events in the meantime.
+func (cp *checkpoint) flush() {
+	cp.flushMutex.Lock()
+	defer cp.flushMutex.Unlock()
+
+	cp.mutex.Lock()
+	if !cp.dirty {
+		cp.mutex.Unlock()
+		return
+	}
+	data, err := cp.snapshot()
+	cp.dirty = false
+	cp.mutex.Unlock()
+
+	if err == nil {
+		err = cp.write(data)
+	}
+	if err != nil {
+		log.Println("Error saving checkpoint ConfigMap", cp.namespace+"/"+cp.name+":", err)
+		// Try again at the next flush.
+		cp.mutex.Lock()
+		cp.dirty = true
+		cp.mutex.Unlock()
+	}
+}
+
+// catchUp compares the checkpoint with the releases which are currently in the cluster and
+// sends the notifications which were missed while KubeWise was not running. The first time
+// KubeWise runs there is nothing to compare with, so the checkpoint is only initialized.
+func (cp *checkpoint) catchUp(handleEvent func(*kwrelease.Event), releases []*rspb.Release) {
+	exists, err := cp.load()
+	if err != nil {
+		log.Println("Error loading checkpoint ConfigMap", cp.namespace+"/"+cp.name+":", err)
+		return
+	}
+
+	// Notify in revision order so that, for example, a failed upgrade is reported before the
+	// upgrade which fixed it.
+	releases = append([]*rspb.Release{}, releases...)
+	sort.SliceStable(releases, func(i, j int) bool {
+		return releases[i].Version < releases[j].Version
+	})
+
+	missedEvents := []*kwrelease.Event{}
+	activeKeys := make(map[string]bool)
+
+	cp.mutex.Lock()
+	for _, release := range releases {
+		key := checkpointKey(release.Namespace, release.Name)
+		activeKeys[key] = true
+		entry, known := cp.entries[key]
+
+		if exists && (!known || release.Version > entry.Revision ||
+			(release.Version == entry.Revision && release.Info.Status.String() != entry.Status)) {
+			if missedEvent := cp.eventForActiveRelease(release); missedEvent != nil {
+				missedEvents = append(missedEvents, missedEvent)
+			}
+		}
+
+		if !known || release.Version >= entry.Revision {
+			cp.entries[key] = &checkpointEntry{
+				Name:         release.Name,
+				Namespace:    release.Namespace,
+				Revision:     release.Version,
+				Status:       release.Info.Status.String(),
+				ChartName:    release.Chart.Metadata.Name,
+				ChartVersion: release.Chart.Metadata.Version,
+				AppVersion:   release.Chart.AppVersion(),
+			}
+		}
+	}
+
+	namespaceFilter := kwrelease.GetNamespaceFilter(cp.cluster)
+	for key, entry := range cp.entries {
+		if activeKeys[key] {
+			continue
+		}
+
+		// The namespace is no longer reported on so its releases were left out of the list.
+		if !namespaceFilter.IsAllowed(entry.Namespace) {
+			delete(cp.entries, key)
+			continue
+		}
+
+		missedEvents = append(missedEvents, kwrelease.NewEventFromRelease(cp.cluster, "delete", entry.toUninstalledRelease()))
+		delete(cp.entries, key)
+	}
+
+	if err := cp.save(); err != nil {
+		log.Println("Error saving checkpoint ConfigMap", cp.namespace+"/"+cp.name+":", err)
+	}
+	cp.mutex.Unlock()
+
+	if len(missedEvents) > 0 {
+		log.Println("Sending", len(missedEvents), "notifications for Helm operations missed while KubeWise was down")
+	}
+
+	for _, missedEvent := range missedEvents {
+		handleEvent(missedEvent)
+	}
+}
+
+// eventForActiveRelease builds an Event from the release storage object, exactly as if it had
+// been updated while KubeWise was watching.
+func (cp *checkpoint) eventForActiveRelease(release *rspb.Release) *kwrelease.Event {
+	releaseEvent, err := kwrelease.LoadEvent(cp.cluster, release.Namespace, release.Name, release.Version)
+	if err != nil {
+		log.Println("Error loading release", release.Namespace+"/"+release.Name, "revision", release.Version)
+		return nil
+	}
+
+	if releaseEvent.GetAction() == kwrelease.ActionPostReplaceSuperseded {
+		return nil
+	}
+
+	return releaseEvent
+}
+
+// toUninstalledRelease rebuilds just enough of a release to describe it in an uninstall
+// notification. The real release was deleted along with its secrets.
+func (entry *checkpointEntry) toUninstalledRelease() *rspb.Release {
+	return &rspb.Release{
+		Name:      entry.Name,
+		Namespace: entry.Namespace,
+		Version:   entry.Revision,
+		Info: &rspb.Info{
+			Status:      rspb.StatusUninstalled,
+			Description: "Uninstalled while KubeWise was not running",
+		},
+		Chart: &chart.Chart{
+			Metadata: &chart.Metadata{
+				Name:       entry.ChartName,
+				Version:    entry.ChartVersion,
+				AppVersion: entry.AppVersion,
+			},
+		},
+	}
+}
@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/RoadieHQ/kubewise/handlers"
+	"github.com/RoadieHQ/kubewise/kwrelease"
+	"github.com/RoadieHQ/kubewise/metrics"
+)
+
+// clusterControllers runs one Controller for each cluster which KubeWise watches. The user
+// receives a single startup message covering every cluster.
+type clusterControllers struct {
+	controllers  []*Controller
+	eventHandler handlers.Handler
+	// digest is nil unless KW_DIGEST_SCHEDULE is set.
+	digest *digestScheduler
+	// startedCh is closed when the controllers start running and stoppedCh when they have all
+	// stopped.
+	startedCh chan struct{}
+	stoppedCh chan struct{}
+}
+
+func newClusterControllers(eventHandler handlers.Handler) *clusterControllers {
+	cc := &clusterControllers{
+		eventHandler: eventHandler,
+		startedCh:    make(chan struct{}),
+		stoppedCh:    make(chan struct{}),
+	}
+	if schedule := getDigestSchedule(); schedule != nil {
+		cc.digest = newDigestScheduler(schedule, eventHandler.HandleDigest)
+	}
+	return cc
+}
+
+func (cc *clusterControllers) add(c *Controller) {
+	c.digest = cc.digest
+	cc.controllers = append(cc.controllers, c)
+}
+
+// listReleases lists the active releases in every cluster. A cluster whose releases can not be
+// listed is included without any releases.
+func (cc *clusterControllers) listReleases() ([]*kwrelease.ClusterReleases, []error) {
+	clusterReleases := make([]*kwrelease.ClusterReleases, len(cc.controllers))
+	listErrors := make([]error, len(cc.controllers))
+	for i, c := range cc.controllers {
+		releases, err := kwrelease.ListActiveReleases(c.cluster)
+		if err != nil {
+			log.Println("Error listing Helm releases in", c.cluster.String()+":", err)
+		}
+		clusterReleases[i] = &kwrelease.ClusterReleases{Cluster: c.cluster.Name, Releases: releases}
+		listErrors[i] = err
+	}
+	return clusterReleases, listErrors
+}
+
+// run sends the startup message and then runs every controller until stopCh is closed. It
+// returns once every controller has drained its queued events.
+//
+// The shutdown message is sent as soon as stopCh is closed, while the queued events drain. If
+// it waited for the drain, it could be lost when the shutdown grace period expires first.
+func (cc *clusterControllers) run(stopCh <-chan struct{}) {
+	close(cc.startedCh)
+	defer close(cc.stoppedCh)
+
+	startupReleases, listErrors := cc.listReleases()
+	cc.eventHandler.HandleServerStartup(startupReleases)
+
+	var running sync.WaitGroup
+	if isShutdownMessageEnabled() {
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			<-stopCh
+			cc.eventHandler.HandleServerShutdown()
+		}()
+	}
+
+	for i, c := range cc.controllers {
+		// Without a complete list of releases, every release in the checkpoint would look like
+		// it had been uninstalled.
+		if listErrors[i] == nil {
+			metrics.SetReleases(c.cluster.Name, startupReleases[i].Releases)
+			if c.checkpoint != nil {
+				c.checkpoint.catchUp(c.handleEvent, startupReleases[i].Releases)
+			}
+			if c.stuckDetector != nil {
+				c.watchPendingReleases(startupReleases[i].Releases)
+			}
+		}
+
+		running.Add(1)
+		go func(c *Controller) {
+			defer running.Done()
+			c.run(stopCh)
+		}(c)
+	}
+
+	if cc.digest != nil {
+		cc.digest.start(stopCh, func() []*kwrelease.ClusterReleases {
+			releases, _ := cc.listReleases()
+			return releases
+		})
+	}
+
+	running.Wait()
+	if cc.digest != nil {
+		cc.digest.stop()
+	}
+}
+
+// queueLength returns the number of events which are waiting to be processed in every cluster.
+func (cc *clusterControllers) queueLength() int {
+	length := 0
+	for _, c := range cc.controllers {
+		length += c.queueLength()
+	}
+	return length
+}
+
+// waitForShutdown blocks until every controller has drained or the grace period has expired.
+// It reports whether the controllers drained. It returns true immediately if the controllers
+// never started, e.g. on a standby replica.
+func (cc *clusterControllers) waitForShutdown(gracePeriod time.Duration) bool {
+	select {
+	case <-cc.startedCh:
+	default:
+		return true
+	}
+
+	select {
+	case <-cc.stoppedCh:
+		return true
+	case <-time.After(gracePeriod):
+		log.Println("KubeWise shutdown grace period of", gracePeriod, "expired. Abandoning", cc.queueLength(), "queued events.")
+		return false
+	}
+}
+
+func (cc *clusterControllers) isRunning() bool {
+	select {
+	case <-cc.startedCh:
+		return true
+	default:
+		return false
+	}
+}
@@ -21,6 +21,21 @@ Modifications made
  2. Remove namespace from Event.
  3. Modified #processItem to cast all interfaces to secrets and releases
     and to handle various types of Helm events.
+ 4. Deleted secrets are carried on the Event so that completed uninstalls can be reported.
+ 5. Added informers for ConfigMaps so that Helm's ConfigMap storage driver is supported.
+ 6. Added a metadata-only informer mode which fetches releases as events are processed.
+ 7. Added namespace include and exclude lists and a namespace label selector.
+ 8. Replaced the single worker with a pool of workers, one queue per worker.
+ 9. Drain queued events on shutdown rather than abandoning them.
+ 10. Keep the Helm release inventory metrics up to date as events are handled.
+ 11. Run one controller per watched cluster and tag events with their cluster.
+ 12. Alert when a release is stuck in a pending state.
+ 13. Time operations from their pending event to the event which settles them.
+ 14. Watch the rollout of the workloads in a release once it has been deployed.
+ 15. Report the results of helm test.
+ 16. Attach the logs of failed hooks and recent warning events to failure notifications.
+ 17. Periodically check deployed releases for objects which were changed outside Helm.
+ 18. Record completed operations for the scheduled digest.
 */
 
 package controller
@@ -30,232 +45,478 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/RoadieHQ/kubewise/handlers"
 	"github.com/RoadieHQ/kubewise/kwrelease"
+	"github.com/RoadieHQ/kubewise/metrics"
 	"github.com/RoadieHQ/kubewise/utils"
 
 	api_v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 )
 
 const maxRetries = 5
 
-var serverStartTime time.Time
-
 // Event is a temporary, serializable reporesentation of a change in a secret or the creation
 // or deletion of a secret. It can be placed on a queue and processed at a later point in
-// the application where the secret is retrieved by a key.
+// the application where the secret is retrieved by a key. ConfigMaps are handled in the same
+// way as secrets when Helm uses the ConfigMap storage driver.
 type Event struct {
-	key        string
-	eventType  string
-	secretType api_v1.SecretType
+	key       string
+	eventType string
+	// driver is the Helm storage driver which the event came from.
+	driver string
+	// informer is the key of the informer in Controller.informers which the event came from.
+	informer string
+	// deletedObject is the last known state of a secret or ConfigMap which has been deleted. It
+	// is only set for "delete" events because the object can no longer be retrieved by key.
+	deletedObject meta_v1.Object
 }
 
 // Controller accepts notifications from the Kubernetes APIs and makes decisions based on the
 // events that occur.
 type Controller struct {
-	clientset    kubernetes.Interface
-	queue        workqueue.RateLimitingInterface
-	informer     cache.SharedIndexInformer
-	eventHandler handlers.Handler
+	// cluster is the cluster which the controller watches.
+	cluster   *utils.Cluster
+	clientset kubernetes.Interface
+	// queues holds one queue per worker. See queueFor.
+	queues []workqueue.RateLimitingInterface
+	// informers holds one informer per Helm storage driver and namespace being watched. They are
+	// keyed by informerKey.
+	informers       map[string]cache.SharedIndexInformer
+	eventHandler    handlers.Handler
+	namespaceFilter *kwrelease.NamespaceFilter
+	// checkpoint is nil unless KW_CHECKPOINT_ENABLED is set.
+	checkpoint   *checkpoint
+	deduplicator *deduplicator
+	durations    *durationTracker
+	// stuckDetector is nil unless KW_STUCK_ALERT_ENABLED is set.
+	stuckDetector *stuckDetector
+	// rolloutWatcher is nil unless KW_ROLLOUT_WATCH_ENABLED is set.
+	rolloutWatcher *rolloutWatcher
+	// testRuns is nil unless KW_TEST_RESULTS_ENABLED is set.
+	testRuns *testRunTracker
+	// failures is nil unless KW_FAILURE_DETAILS_ENABLED is set.
+	failures *failureCollector
+	// driftDetector is nil unless KW_DRIFT_DETECTION_ENABLED is set.
+	driftDetector *driftDetector
+	// digest is shared by the controllers of every cluster. It is nil unless KW_DIGEST_SCHEDULE
+	// is set.
+	digest *digestScheduler
+	// startTime is when the controller started. Releases created before it were already in the
+	// cluster and are not reported.
+	startTime time.Time
+	// workers tracks the running workers so that shutdown can wait for them to finish.
+	workers sync.WaitGroup
+	// startedCh is closed when the controller starts running and stoppedCh when it has stopped.
+	startedCh chan struct{}
+	stoppedCh chan struct{}
+	// watchActivity and workerActivity are used by the liveness check.
+	watchActivity  *watchActivity
+	workerActivity *workerActivity
 }
 
 // Start watches the Kubernetes secrets API. When notified, sends a message through a channel.
 // Start is blocking. It runs until it receives a SIGTERM or SIGINT.
+//
+// One controller is run for each cluster which KubeWise watches. When leader election is
+// enabled, the server startup message is sent and the secrets API is watched only once this
+// replica becomes the leader.
 func Start(eventHandler handlers.Handler) {
-	kubeClient := utils.GetClient()
-	namespace := ""
-	if value, ok := os.LookupEnv("KW_NAMESPACE"); ok {
-		namespace = value
-		log.Println("KubeWise operating in namespace", value, ". Operations in other namespaces will be ignored.")
-	}
-
-	informer := cache.NewSharedIndexInformer(
-		&cache.ListWatch{
-			ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
-				return kubeClient.CoreV1().Secrets(namespace).List(options)
-			},
-			WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
-				return kubeClient.CoreV1().Secrets(namespace).Watch(options)
-			},
-		},
-		&api_v1.Secret{},
-		0,
-		cache.Indexers{},
-	)
+	namespaceFilter := kwrelease.GetNamespaceFilter(nil)
+	if len(namespaceFilter.Include) > 0 {
+		log.Println("KubeWise operating in namespaces", strings.Join(namespaceFilter.Include, ", "), ". Operations in other namespaces will be ignored.")
+	}
+	if len(namespaceFilter.Exclude) > 0 {
+		log.Println("KubeWise ignoring operations in namespaces", strings.Join(namespaceFilter.Exclude, ", "))
+	}
+	if namespaceFilter.Selector != nil {
+		log.Println("KubeWise ignoring operations in namespaces which do not match", namespaceFilter.Selector.String())
+	}
+
+	if isMetadataOnly() {
+		log.Println("KubeWise caching release metadata only. Releases will be fetched as events are processed.")
+	}
 
-	c := newResourceController(kubeClient, eventHandler, informer)
+	clusters := newClusterControllers(eventHandler)
+	for _, cluster := range utils.GetClusters() {
+		clusters.add(newClusterController(cluster, eventHandler))
+	}
+
+	metrics.RegisterQueueDepth(func() float64 {
+		return float64(clusters.queueLength())
+	})
+
+	server := clusters.startHTTPServer()
+
+	// stopCh stops the controllers. releaseCh releases the leader lease once the controllers
+	// have stopped and doneCh is closed once the lease has been released.
 	stopCh := make(chan struct{})
-	defer close(stopCh)
+	releaseCh := make(chan struct{})
+	doneCh := make(chan struct{})
 
-	go c.run(stopCh)
+	run := func() {
+		clusters.run(stopCh)
+	}
+
+	if isLeaderElectionEnabled() {
+		go func() {
+			defer close(doneCh)
+			// The lease is always kept in the cluster which KubeWise runs in.
+			runWithLeaderElection(utils.GetClient(), releaseCh, run)
+		}()
+	} else {
+		close(doneCh)
+		go run()
+	}
 
 	sigterm := make(chan os.Signal, 1)
 	signal.Notify(sigterm, syscall.SIGTERM)
 	signal.Notify(sigterm, syscall.SIGINT)
 	<-sigterm
+
+	log.Println("KubeWise shutting down")
+	close(stopCh)
+	drained := clusters.waitForShutdown(getShutdownGracePeriod())
+
+	// Release the leader lease only once in-flight notifications have been delivered so that a
+	// standby doesn't send them a second time. It then takes over straight away. If the drain
+	// did not finish, the lease is left to expire once this process has exited.
+	if drained {
+		close(releaseCh)
+		<-doneCh
+	} else if isLeaderElectionEnabled() {
+		log.Println("KubeWise not releasing leader lease because events are still being processed. A standby will take over when it expires.")
+	}
+
+	stopHTTPServer(server)
 }
 
-func newResourceController(client kubernetes.Interface, eventHandler handlers.Handler, informer cache.SharedIndexInformer) *Controller {
-	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+// newClusterController creates a controller which watches the Helm releases in one cluster.
+func newClusterController(cluster *utils.Cluster, eventHandler handlers.Handler) *Controller {
+	kubeClient := cluster.GetClient()
+	namespaceFilter := kwrelease.GetNamespaceFilter(cluster)
+
+	var metadataClient metadata.Interface
+	if isMetadataOnly() {
+		metadataClient = cluster.GetMetadataClient()
+	}
+
+	activity := newWatchActivity()
+	informers := make(map[string]cache.SharedIndexInformer)
+	for _, namespace := range namespaceFilter.WatchedNamespaces() {
+		for _, driver := range kwrelease.GetStorageDrivers() {
+			if namespace == "" {
+				log.Println("KubeWise watching Helm releases stored in", driver+"s", "in all namespaces of", cluster)
+			} else {
+				log.Println("KubeWise watching Helm releases stored in", driver+"s", "in namespace", namespace, "of", cluster)
+			}
+			informers[informerKey(driver, namespace)] = newReleaseInformer(kubeClient, metadataClient, driver, namespace, activity)
+		}
+	}
+
+	c := newResourceController(kubeClient, eventHandler, informers)
+	c.cluster = cluster
+	c.namespaceFilter = namespaceFilter
+	c.watchActivity = activity
+	if isCheckpointEnabled() {
+		// Checkpoints are kept alongside KubeWise, whichever cluster they are for.
+		c.checkpoint = newCheckpoint(utils.GetClient(), cluster)
+	}
+	if isStuckAlertEnabled() {
+		c.stuckDetector = newStuckDetector(eventHandler.HandleStuckRelease)
+	}
+	if isRolloutWatchEnabled() {
+		c.rolloutWatcher = newRolloutWatcher(kubeClient, eventHandler.HandleRolloutStatus)
+	}
+	if isTestResultsEnabled() {
+		c.testRuns = newTestRunTracker(eventHandler.HandleTestRun)
+	}
+	if isFailureDetailsEnabled() {
+		c.failures = newFailureCollector(kubeClient)
+	}
+	if isDriftDetectionEnabled() {
+		c.driftDetector = newDriftDetector(cluster, eventHandler.HandleReleaseDrift)
+	}
+
+	return c
+}
+
+func newResourceController(client kubernetes.Interface, eventHandler handlers.Handler, informers map[string]cache.SharedIndexInformer) *Controller {
+	workers := getWorkerCount()
+	c := &Controller{
+		clientset:      client,
+		informers:      informers,
+		queues:         newQueues(workers),
+		workerActivity: newWorkerActivity(workers),
+		eventHandler:   eventHandler,
+		deduplicator:   newDeduplicator(),
+		durations:      newDurationTracker(),
+		startedCh:      make(chan struct{}),
+		stoppedCh:      make(chan struct{}),
+	}
+
+	for key, informer := range informers {
+		driver, _ := splitInformerKey(key)
+		c.addEventHandler(informer, driver, key)
+	}
+
+	return c
+}
+
+// informerKey identifies the informer for a Helm storage driver in a namespace. A blank
+// namespace means the informer watches every namespace.
+func informerKey(driver string, namespace string) string {
+	return driver + "/" + namespace
+}
+
+func splitInformerKey(key string) (driver string, namespace string) {
+	parts := strings.SplitN(key, "/", 2)
+	return parts[0], parts[1]
+}
+
+func (c *Controller) addEventHandler(informer cache.SharedIndexInformer, driver string, key string) {
 	var newEvent Event
 	var err error
 
 	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: func(secret interface{}) {
-			newEvent.key, err = cache.MetaNamespaceKeyFunc(secret)
+		AddFunc: func(obj interface{}) {
+			newEvent.key, err = cache.MetaNamespaceKeyFunc(obj)
 			newEvent.eventType = "create"
-			newEvent.secretType = secret.(*api_v1.Secret).Type
+			newEvent.driver = driver
+			newEvent.informer = key
+			newEvent.deletedObject = nil
 
 			if err == nil {
-				queue.Add(newEvent)
+				c.enqueue(newEvent)
 			}
 		},
 
-		UpdateFunc: func(secret, new interface{}) {
-			newEvent.key, err = cache.MetaNamespaceKeyFunc(secret)
+		UpdateFunc: func(obj, new interface{}) {
+			newEvent.key, err = cache.MetaNamespaceKeyFunc(obj)
 			newEvent.eventType = "update"
-			newEvent.secretType = secret.(*api_v1.Secret).Type
+			newEvent.driver = driver
+			newEvent.informer = key
+			newEvent.deletedObject = nil
 
 			if err == nil {
-				queue.Add(newEvent)
+				c.enqueue(newEvent)
 			}
 		},
 
-		DeleteFunc: func(secret interface{}) {
-			newEvent.key, err = cache.DeletionHandlingMetaNamespaceKeyFunc(secret)
+		DeleteFunc: func(obj interface{}) {
+			// When the watch misses a deletion, the informer hands us a tombstone which wraps the
+			// last state of the object that it knew about.
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+
+			deletedObject, ok := obj.(meta_v1.Object)
+			if !ok {
+				log.Println("Unable to cast deleted object (interface) as", driver+":", obj)
+				return
+			}
+
+			newEvent.key, err = cache.DeletionHandlingMetaNamespaceKeyFunc(deletedObject)
 			newEvent.eventType = "delete"
-			newEvent.secretType = secret.(*api_v1.Secret).Type
+			newEvent.driver = driver
+			newEvent.informer = key
+			newEvent.deletedObject = deletedObject
 
 			if err == nil {
-				queue.Add(newEvent)
+				c.enqueue(newEvent)
 			}
 		},
 	})
-
-	return &Controller{
-		clientset:    client,
-		informer:     informer,
-		queue:        queue,
-		eventHandler: eventHandler,
-	}
 }
 
+// run starts the informers and workers. When stopCh is closed, the informers stop and run
+// returns once the queued events have been drained.
 func (c *Controller) run(stopCh <-chan struct{}) {
 	defer utilruntime.HandleCrash()
-	defer c.queue.ShutDown()
+	close(c.startedCh)
+	defer close(c.stoppedCh)
 
-	log.Println("Starting KubeWise controller")
-	serverStartTime = time.Now().Local()
+	log.Println("Starting KubeWise controller for", c.cluster)
+	c.startTime = time.Now().Local()
 
-	go c.informer.Run(stopCh)
+	for _, informer := range c.informers {
+		go informer.Run(stopCh)
+	}
 
 	if !cache.WaitForCacheSync(stopCh, c.HasSynced) {
-		utilruntime.HandleError(fmt.Errorf("Timed out waiting for caches to sync"))
+		utilruntime.HandleError(fmt.Errorf("Timed out waiting for caches to sync for %s", c.cluster))
 		return
 	}
 
-	log.Println("KubeWise controller ready")
+	log.Println("KubeWise controller for", c.cluster, "ready with", len(c.queues), "workers")
 
-	wait.Until(c.runWorker, time.Second, stopCh)
+	for worker := range c.queues {
+		c.workers.Add(1)
+		go c.runWorker(worker)
+	}
+
+	if c.driftDetector != nil {
+		c.driftDetector.start(stopCh)
+	}
+	if c.checkpoint != nil {
+		c.checkpoint.start(stopCh)
+	}
+
+	<-stopCh
+	c.drain()
 }
 
-// HasSynced is needed to satisfy the Controller interface.
+// HasSynced is needed to satisfy the Controller interface. It is true once every informer
+// has synced.
 func (c *Controller) HasSynced() bool {
-	return c.informer.HasSynced()
+	for _, informer := range c.informers {
+		if !informer.HasSynced() {
+			return false
+		}
+	}
+	return true
 }
 
-// LastSyncResourceVersion is needed to satisfy the Controller interface.
+// LastSyncResourceVersion is needed to satisfy the Controller interface. With more than one
+// informer, the versions are joined by a comma.
 func (c *Controller) LastSyncResourceVersion() string {
-	return c.informer.LastSyncResourceVersion()
+	versions := []string{}
+	for _, informer := range c.informers {
+		versions = append(versions, informer.LastSyncResourceVersion())
+	}
+	return strings.Join(versions, ",")
 }
 
-func (c *Controller) runWorker() {
-	for c.processNextItem() {
+func (c *Controller) runWorker(worker int) {
+	defer c.workers.Done()
+	defer utilruntime.HandleCrash()
+
+	for c.processNextItem(worker) {
 		// infinite loop
 	}
 }
 
-func (c *Controller) processNextItem() bool {
-	newEvent, quit := c.queue.Get()
+func (c *Controller) processNextItem(worker int) bool {
+	queue := c.queues[worker]
+	newEvent, quit := queue.Get()
 
 	if quit {
 		return false
 	}
-	defer c.queue.Done(newEvent)
+	defer queue.Done(newEvent)
 
-	err := c.processItem(newEvent.(Event))
+	c.workerActivity.start(worker)
+	defer c.workerActivity.finish(worker)
 
-	if err == nil {
-		c.queue.Forget(newEvent)
-	} else if c.queue.NumRequeues(newEvent) < maxRetries {
-		log.Printf("Error processing %s (will retry): %v", newEvent.(Event).key, err)
-		c.queue.AddRateLimited(newEvent)
-	} else {
+	if err := c.processItemWithRetries(newEvent.(Event)); err != nil {
 		log.Printf("Error processing %s (giving up): %v", newEvent.(Event).key, err)
-		c.queue.Forget(newEvent)
+		metrics.QueueGiveUps.Inc()
 		utilruntime.HandleError(err)
 	}
+	queue.Forget(newEvent)
 
 	return true
 }
 
 func (c *Controller) processItem(newEvent Event) error {
-	object, _, err := c.informer.GetIndexer().GetByKey(newEvent.key)
+	var object interface{}
+	var err error
 
-	// GetByKey returns a nil object in the case where a Helm secret has been deleted. This means
-	// we don't have access to the original secret at this point and can't inform the user about
-	// which application has been successfully deleted.
-	//
-	// One approach to investigate in future would be to put the relevant details on the Event
-	// and use that to provide the user information about what has been uninstalled.
+	if namespace, _, _ := cache.SplitMetaNamespaceKey(newEvent.key); !c.namespaceFilter.IsAllowed(namespace) {
+		return nil
+	}
+
+	// GetByKey returns a nil object in the case where a Helm secret has been deleted. The last
+	// known state of the secret is carried on the Event instead so that we can inform the user
+	// about which application has been uninstalled.
+	if newEvent.eventType == "delete" && newEvent.deletedObject != nil {
+		object = newEvent.deletedObject
+	} else {
+		object, _, err = c.informers[newEvent.informer].GetIndexer().GetByKey(newEvent.key)
+	}
 
 	if err != nil {
-		log.Fatalf("Error fetching secret with key %s from store: %v", newEvent.key, err)
+		log.Fatalf("Error fetching %s with key %s from store: %v", newEvent.driver, newEvent.key, err)
 		return err
 	}
 
 	// Uninstalling a Helm chart triggers a processItem but the secret has been deleted.
 	// Without a nil check, we can see a panic when we type check the secret below.
 	if object == nil {
-		log.Println("Skipping nil secret", newEvent.eventType, "event for secret type:", newEvent.secretType)
+		log.Println("Skipping nil", newEvent.driver, newEvent.eventType, "event for key:", newEvent.key)
 		return nil
 	}
 
-	secret, ok := object.(*api_v1.Secret)
+	// In metadata-only mode, the informer cache does not hold the encoded release.
+	if partialObject, ok := object.(*meta_v1.PartialObjectMetadata); ok {
+		// Avoid fetching every release in the cluster at startup only to skip it below.
+		if newEvent.eventType == "create" && partialObject.CreationTimestamp.Sub(c.startTime).Seconds() <= 0 {
+			return nil
+		}
 
-	if !ok {
-		log.Println("Unable to cast 'object' (interface) as secret in", newEvent.eventType, "event:", object)
-		return nil
+		object, err = c.getFullObject(newEvent, partialObject)
+		if err != nil {
+			return err
+		}
+		if object == nil {
+			return nil
+		}
 	}
 
-	if secret.Type != "helm.sh/release.v1" {
-		log.Println("Skipping non-helm secret", newEvent.eventType, "event:", secret.Type)
+	releaseEvent := &kwrelease.Event{SecretAction: newEvent.eventType, Cluster: c.cluster}
+
+	switch object := object.(type) {
+	case *kwrelease.Event:
+		releaseEvent = object
+
+	case *api_v1.Secret:
+		if object.Type != "helm.sh/release.v1" {
+			log.Println("Skipping non-helm secret", newEvent.eventType, "event:", object.Type)
+			return nil
+		}
+		releaseEvent.CurrentReleaseSecret = object
+
+	case *api_v1.ConfigMap:
+		if object.GetLabels()["owner"] != "helm" {
+			log.Println("Skipping non-helm configmap", newEvent.eventType, "event:", newEvent.key)
+			return nil
+		}
+		releaseEvent.CurrentReleaseConfigMap = object
+
+	default:
+		log.Println("Unable to cast 'object' (interface) as secret or configmap in", newEvent.eventType, "event:", object)
 		return nil
 	}
 
-	releaseEvent := &kwrelease.Event{
-		SecretAction:         newEvent.eventType,
-		CurrentReleaseSecret: secret,
+	if releaseEvent.CurrentReleaseSecret != nil || releaseEvent.CurrentReleaseConfigMap != nil {
+		err = releaseEvent.Init()
+
+		if err != nil {
+			return nil
+		}
 	}
-	err = releaseEvent.Init()
 
-	if err != nil {
-		return nil
+	// Deleting a pending revision by hand settles a stuck release, even though it looks like
+	// bookkeeping below.
+	if c.stuckDetector != nil && releaseEvent.SecretAction == "delete" &&
+		releaseEvent.GetAction() == kwrelease.ActionPostReplaceSuperseded {
+		c.stuckDetector.observeDeletion(releaseEvent)
 	}
 
-	// This event is the old release secret being marked as superseeded. There is no need to
-	// inform the user of this action. It is internal bookkeeping.
+	// This event is the old release secret being marked as superseeded or an old release secret
+	// being purged from the history. There is no need to inform the user of this action. It is
+	// internal bookkeeping.
 	if releaseEvent.GetAction() == kwrelease.ActionPostReplaceSuperseded {
 		return nil
 	}
@@ -267,21 +528,99 @@ func (c *Controller) processItem(newEvent Event) error {
 		// being triggered for each Helm chart which is already in the cluster. This could be a lot
 		// of Slack messages being sent.
 		//
-		// Checking if the server started up less than zero seconds ago is a hacky way to prevent
-		// this handler spam.
-		if secret.ObjectMeta.CreationTimestamp.Sub(serverStartTime).Seconds() > 0 {
-			c.eventHandler.HandleEvent(releaseEvent)
+		// Checking if the controller started up less than zero seconds ago is a hacky way to prevent
+		// this handler spam. Operations which happened while KubeWise was down are reported by
+		// the checkpoint instead.
+		if releaseEvent.GetSecretCreationTimestamp().Sub(c.startTime).Seconds() > 0 {
+			c.handleEvent(releaseEvent)
 		}
 		return nil
 
 	case "update":
-		c.eventHandler.HandleEvent(releaseEvent)
+		c.handleEvent(releaseEvent)
 		return nil
 
 	case "delete":
-		c.eventHandler.HandleEvent(releaseEvent)
+		c.handleEvent(releaseEvent)
 		return nil
 	}
 
 	return nil
 }
+
+// getFullObject fetches the Secret or ConfigMap which a metadata-only informer event refers to.
+// A deleted object can no longer be fetched, so an Event is built from the release details
+// which Helm stores in its labels instead.
+func (c *Controller) getFullObject(newEvent Event, partialObject *meta_v1.PartialObjectMetadata) (interface{}, error) {
+	if newEvent.eventType == "delete" {
+		release := kwrelease.DecodeReleaseFromLabels(partialObject.Namespace, partialObject.Labels)
+		return kwrelease.NewEventFromRelease(c.cluster, newEvent.eventType, release), nil
+	}
+
+	var object interface{}
+	var err error
+
+	if newEvent.driver == kwrelease.DriverConfigMap {
+		object, err = c.clientset.CoreV1().ConfigMaps(partialObject.Namespace).Get(partialObject.Name, meta_v1.GetOptions{})
+	} else {
+		object, err = c.clientset.CoreV1().Secrets(partialObject.Namespace).Get(partialObject.Name, meta_v1.GetOptions{})
+	}
+
+	// The object was deleted before the event was processed. The delete event will follow.
+	if errors.IsNotFound(err) {
+		log.Println("Skipping", newEvent.driver, newEvent.eventType, "event for deleted object:", newEvent.key)
+		return nil, nil
+	}
+
+	return object, err
+}
+
+func (c *Controller) handleEvent(releaseEvent *kwrelease.Event) {
+	// The inventory reflects the state of the cluster, so it is updated even when the user has
+	// already been notified.
+	if releaseEvent.GetAction() == kwrelease.ActionPostUninstall {
+		metrics.DeleteRelease(releaseEvent.GetClusterName(), releaseEvent.GetNamespace(), releaseEvent.GetAppName())
+	} else {
+		metrics.SetRelease(releaseEvent.GetClusterName(), releaseEvent.GetCurrentRelease())
+	}
+
+	// Test results are recorded without changing the revision or status of the release, so
+	// they must be looked for before duplicates are suppressed.
+	if c.testRuns != nil {
+		c.testRuns.observe(releaseEvent)
+	}
+
+	if c.deduplicator.isDuplicate(releaseEvent) {
+		metrics.NotificationsSuppressed.Inc()
+		return
+	}
+
+	metrics.EventsProcessed.WithLabelValues(releaseEvent.GetAction().String()).Inc()
+
+	c.durations.observe(releaseEvent)
+	if duration := releaseEvent.GetDuration(); duration > 0 {
+		metrics.ObserveOperationDuration(releaseEvent.GetChartName(), releaseEvent.GetAction().String(), duration)
+	}
+
+	if c.failures != nil {
+		c.failures.collect(releaseEvent)
+	}
+
+	c.eventHandler.HandleEvent(releaseEvent)
+
+	if c.digest != nil {
+		c.digest.record(releaseEvent)
+	}
+
+	if c.stuckDetector != nil {
+		c.stuckDetector.observe(releaseEvent)
+	}
+
+	if c.rolloutWatcher != nil {
+		c.rolloutWatcher.observe(releaseEvent)
+	}
+
+	if c.checkpoint != nil {
+		c.checkpoint.record(releaseEvent)
+	}
+}
@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/RoadieHQ/kubewise/kwrelease"
+)
+
+// deduplicator remembers the last notification sent for each release. Informer resyncs, watch
+// reconnects and Helm updating the labels on a release secret can all produce an update event
+// for a revision and status which the user has already been told about.
+type deduplicator struct {
+	mutex sync.Mutex
+	// last maps a release, e.g. namespace/name, to the revision, status and action it was last
+	// notified with.
+	last map[string]string
+}
+
+func newDeduplicator() *deduplicator {
+	return &deduplicator{
+		last: make(map[string]string),
+	}
+}
+
+// The action is included alongside the status because an uninstall is reported twice with the
+// same revision and status. First when Helm marks the release as uninstalling and again when
+// the release secret is deleted.
+func notificationKey(releaseEvent *kwrelease.Event) string {
+	return fmt.Sprintf("%d/%s/%s", releaseEvent.GetRevision(), releaseEvent.GetStatus(), releaseEvent.GetAction())
+}
+
+// isDuplicate reports whether the user has already been notified about this revision and
+// status of the release. If not, the event is remembered so that repeats can be suppressed.
+func (d *deduplicator) isDuplicate(releaseEvent *kwrelease.Event) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	release := releaseEvent.GetNamespace() + "/" + releaseEvent.GetAppName()
+	key := notificationKey(releaseEvent)
+
+	if d.last[release] == key {
+		log.Println("Suppressing duplicate", releaseEvent.GetAction(), "notification for", release, "revision", releaseEvent.GetRevision())
+		return true
+	}
+
+	// The release name may be reused by a fresh install, which starts again from revision 1.
+	if releaseEvent.GetAction() == kwrelease.ActionPostUninstall {
+		delete(d.last, release)
+	} else {
+		d.last[release] = key
+	}
+
+	return false
+}
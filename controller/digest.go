@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/RoadieHQ/kubewise/kwrelease"
+	"github.com/RoadieHQ/kubewise/utils"
+)
+
+// Changes are kept in memory until the next digest. A busy set of clusters on a weekly schedule
+// could otherwise use a lot of it.
+const maxDigestChanges = 1000
+
+// getDigestSchedule returns the schedule set by KW_DIGEST_SCHEDULE, or nil when digests are
+// turned off.
+func getDigestSchedule() *utils.Schedule {
+	spec, ok := os.LookupEnv("KW_DIGEST_SCHEDULE")
+	if !ok || spec == "" {
+		return nil
+	}
+
+	schedule, err := utils.ParseSchedule(spec)
+	if err != nil {
+		log.Fatalln("KW_DIGEST_SCHEDULE is invalid:", err)
+	}
+	return schedule
+}
+
+// digestChangeActions are the actions which complete an operation. The events which start an
+// operation would repeat every change in the digest.
+var digestChangeActions = map[kwrelease.Action]bool{
+	kwrelease.ActionPostInstall:   true,
+	kwrelease.ActionPostUpgrade:   true,
+	kwrelease.ActionPostRollback:  true,
+	kwrelease.ActionPostReplace:   true,
+	kwrelease.ActionPostUninstall: true,
+	kwrelease.ActionFailedInstall: true,
+	kwrelease.ActionFailedReplace: true,
+}
+
+// digestScheduler sends a summary of every watched cluster on a cron schedule. It is shared by
+// the controllers of every cluster, which record the changes they handle.
+//
+// Changes are only kept in memory. A restart, or another replica becoming the leader, loses the
+// changes recorded since the last digest. The digest says which period it covers, so the next
+// one only claims to cover the time since KubeWise started.
+type digestScheduler struct {
+	schedule *utils.Schedule
+	notify   func(*kwrelease.Digest)
+	mutex    sync.Mutex
+	since    time.Time
+	changes  []*kwrelease.ReleaseChange
+	dropped  int
+	running  sync.WaitGroup
+}
+
+func newDigestScheduler(schedule *utils.Schedule, notify func(*kwrelease.Digest)) *digestScheduler {
+	return &digestScheduler{
+		schedule: schedule,
+		notify:   notify,
+		since:    time.Now(),
+	}
+}
+
+// record keeps a change for the next digest.
+func (d *digestScheduler) record(releaseEvent *kwrelease.Event) {
+	if !digestChangeActions[releaseEvent.GetAction()] {
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if len(d.changes) >= maxDigestChanges {
+		d.dropped++
+		return
+	}
+	d.changes = append(d.changes, kwrelease.NewReleaseChange(releaseEvent, time.Now()))
+}
+
+// start sends a digest each time the schedule comes around until stopCh is closed. The
+// releases in each cluster are listed by listReleases when the digest is sent.
+func (d *digestScheduler) start(stopCh <-chan struct{}, listReleases func() []*kwrelease.ClusterReleases) {
+	d.running.Add(1)
+	go func() {
+		defer d.running.Done()
+
+		for {
+			next := d.schedule.Next(time.Now())
+			log.Println("Next KubeWise digest will be sent at", next)
+
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-stopCh:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			d.send(listReleases())
+		}
+	}()
+}
+
+// stop waits for a digest which is being sent to finish. It must only be called after stopCh
+// has been closed.
+func (d *digestScheduler) stop() {
+	d.running.Wait()
+}
+
+func (d *digestScheduler) send(clusters []*kwrelease.ClusterReleases) {
+	d.mutex.Lock()
+	digest := &kwrelease.Digest{
+		Since:          d.since,
+		Until:          time.Now(),
+		Clusters:       clusters,
+		Changes:        d.changes,
+		DroppedChanges: d.dropped,
+	}
+	d.since = digest.Until
+	d.changes = nil
+	d.dropped = 0
+	d.mutex.Unlock()
+
+	log.Println("Sending KubeWise digest with", len(digest.Changes)+digest.DroppedChanges, "changes")
+	d.notify(digest)
+}
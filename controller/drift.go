@@ -0,0 +1,219 @@
+package controller
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/RoadieHQ/kubewise/kwrelease"
+	"github.com/RoadieHQ/kubewise/metrics"
+	"github.com/RoadieHQ/kubewise/utils"
+	rspb "helm.sh/helm/v3/pkg/release"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const defaultDriftCheckInterval = time.Hour
+
+func isDriftDetectionEnabled() bool {
+	return utils.GetEnvBool("KW_DRIFT_DETECTION_ENABLED", false)
+}
+
+// driftDetector periodically compares the manifest of each deployed release with the live
+// objects in the cluster. It tells the user about objects which were changed outside Helm,
+// e.g. with kubectl edit, before the next upgrade silently overwrites the change.
+type driftDetector struct {
+	cluster  *utils.Cluster
+	interval time.Duration
+	// ignoredPaths are fields which are expected to change, such as spec.replicas when a
+	// HorizontalPodAutoscaler is in use.
+	ignoredPaths []string
+	notify       func(*kwrelease.ReleaseDrift)
+	// reported maps a release to the fingerprint of the drift which the user was last told
+	// about. The same drift is only reported once.
+	reported map[driftKey]string
+	// measured holds the releases which have a drift metric.
+	measured map[driftKey]bool
+	// forbiddenKinds holds the kinds of object which KubeWise is not allowed to get. The RBAC
+	// rules may leave out kinds, such as Secrets, on purpose.
+	forbiddenKinds map[string]bool
+	running        sync.WaitGroup
+}
+
+type driftKey struct {
+	namespace string
+	name      string
+}
+
+func newDriftDetector(cluster *utils.Cluster, notify func(*kwrelease.ReleaseDrift)) *driftDetector {
+	interval := utils.GetEnvDuration("KW_DRIFT_CHECK_INTERVAL", defaultDriftCheckInterval)
+	if interval <= 0 {
+		log.Println("KW_DRIFT_CHECK_INTERVAL must be greater than zero. Using", defaultDriftCheckInterval)
+		interval = defaultDriftCheckInterval
+	}
+
+	return &driftDetector{
+		cluster:        cluster,
+		interval:       interval,
+		ignoredPaths:   utils.GetEnvList("KW_DRIFT_IGNORE_FIELDS"),
+		notify:         notify,
+		reported:       make(map[driftKey]string),
+		measured:       make(map[driftKey]bool),
+		forbiddenKinds: make(map[string]bool),
+	}
+}
+
+// start checks for drift straight away and then every interval until stopCh is closed.
+func (d *driftDetector) start(stopCh <-chan struct{}) {
+	d.running.Add(1)
+	go func() {
+		defer d.running.Done()
+
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+
+		for {
+			d.check(stopCh)
+
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// stop waits for a check which is underway to finish. It must only be called after stopCh has
+// been closed.
+func (d *driftDetector) stop() {
+	d.running.Wait()
+}
+
+// check compares every deployed release with the cluster, updates the drift metric and sends
+// a notification for each release whose drift has changed since it was last reported.
+func (d *driftDetector) check(stopCh <-chan struct{}) {
+	releases, err := kwrelease.ListActiveReleases(d.cluster)
+	if err != nil {
+		log.Println("Error listing Helm releases in", d.cluster.String()+". Skipping drift check:", err)
+		return
+	}
+
+	checked := make(map[driftKey]bool)
+	for _, release := range releases {
+		// Releases which failed or are part way through an operation are not expected to match
+		// their manifest.
+		if release.Info == nil || release.Info.Status != rspb.StatusDeployed {
+			continue
+		}
+
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+
+		releaseEvent := kwrelease.NewEventFromRelease(d.cluster, "update", release)
+		key := driftKey{namespace: releaseEvent.GetNamespace(), name: releaseEvent.GetAppName()}
+		checked[key] = true
+
+		drift := d.findReleaseDrift(releaseEvent)
+		metrics.SetDriftedFields(d.cluster.Name, key.namespace, key.name, drift.GetFieldCount())
+		d.measured[key] = true
+
+		if len(drift.Resources) == 0 {
+			delete(d.reported, key)
+			continue
+		}
+
+		fingerprint := drift.GetFingerprint()
+		if d.reported[key] == fingerprint {
+			continue
+		}
+		d.reported[key] = fingerprint
+
+		log.Println("Release", key.namespace+"/"+key.name, "in", d.cluster, "has", drift.GetFieldCount(), "fields which were changed outside Helm")
+		d.notify(drift)
+	}
+
+	// Forget the releases which have been uninstalled or are no longer deployed.
+	for key := range d.measured {
+		if !checked[key] {
+			metrics.DeleteDriftedFields(d.cluster.Name, key.namespace, key.name)
+			delete(d.measured, key)
+			delete(d.reported, key)
+		}
+	}
+}
+
+func (d *driftDetector) findReleaseDrift(releaseEvent *kwrelease.Event) *kwrelease.ReleaseDrift {
+	drift := &kwrelease.ReleaseDrift{
+		Event:     releaseEvent,
+		Resources: []*kwrelease.ResourceDrift{},
+		CheckedAt: time.Now(),
+	}
+
+	for _, resource := range releaseEvent.GetManifestResources() {
+		live, err := d.getLiveObject(resource)
+		if errors.IsForbidden(err) {
+			if !d.forbiddenKinds[resource.Kind] {
+				d.forbiddenKinds[resource.Kind] = true
+				log.Println("KubeWise is not allowed to get", resource.Kind, "objects in", d.cluster.String()+". They will not be checked for drift.")
+			}
+			continue
+		}
+		if err != nil && !errors.IsNotFound(err) {
+			log.Println("Error getting", resource.Kind, resource.Namespace+"/"+resource.Name, "in", d.cluster.String()+". Skipping it:", err)
+			continue
+		}
+
+		resourceDrift := &kwrelease.ResourceDrift{
+			Kind:      resource.Kind,
+			Namespace: resource.Namespace,
+			Name:      resource.Name,
+			Missing:   err != nil,
+		}
+		if live != nil {
+			resourceDrift.Fields = kwrelease.FindDrift(resource, live, d.ignoredPaths)
+		}
+
+		if resourceDrift.Missing || len(resourceDrift.Fields) > 0 {
+			drift.Resources = append(drift.Resources, resourceDrift)
+		}
+	}
+
+	return drift
+}
+
+// getLiveObject fetches the object in the cluster which a rendered object was applied to.
+func (d *driftDetector) getLiveObject(resource *kwrelease.ManifestResource) (map[string]interface{}, error) {
+	gvk := schema.FromAPIVersionAndKind(resource.APIVersion, resource.Kind)
+	mapper := d.cluster.GetRESTMapper()
+
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		// The kind may have been added by a CRD since the mapper was first used.
+		mapper.Reset()
+		mapping, err = mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	client := d.cluster.GetDynamicClient().Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		object, err := client.Namespace(resource.Namespace).Get(resource.Name, meta_v1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return object.Object, nil
+	}
+
+	object, err := client.Get(resource.Name, meta_v1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return object.Object, nil
+}
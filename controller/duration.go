@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/RoadieHQ/kubewise/kwrelease"
+)
+
+// durationTracker correlates the pending and settled events for a release revision so that the
+// user can be told how long an install, upgrade, rollback or uninstall took.
+type durationTracker struct {
+	mutex sync.Mutex
+	// started maps a release, e.g. namespace/name, to the operation which is underway.
+	started map[string]startedOperation
+}
+
+type startedOperation struct {
+	revision int
+	at       time.Time
+}
+
+func newDurationTracker() *durationTracker {
+	return &durationTracker{
+		started: make(map[string]startedOperation),
+	}
+}
+
+// observe remembers when a pending operation started. When the operation settles, the time it
+// took is set on the event. Operations which started before KubeWise was watching have no
+// duration.
+func (t *durationTracker) observe(releaseEvent *kwrelease.Event) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	key := releaseEvent.GetNamespace() + "/" + releaseEvent.GetAppName()
+	started, ok := t.started[key]
+
+	// The deletion which completes an uninstall settles it, even though the deleted release is
+	// still marked as uninstalling.
+	if releaseEvent.IsPending() && releaseEvent.GetAction() != kwrelease.ActionPostUninstall {
+		if !ok || started.revision != releaseEvent.GetRevision() {
+			t.started[key] = startedOperation{
+				revision: releaseEvent.GetRevision(),
+				at:       releaseEvent.GetOperationStartedAt(),
+			}
+		}
+		return
+	}
+
+	// A settled revision other than the one which was pending means the pending operation was
+	// abandoned. Its duration is unknown.
+	if ok && started.revision == releaseEvent.GetRevision() {
+		releaseEvent.SetDuration(time.Since(started.at))
+	}
+	delete(t.started, key)
+}
@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/RoadieHQ/kubewise/kwrelease"
+	"github.com/RoadieHQ/kubewise/utils"
+	api_v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	defaultFailureLogLines = 20
+	defaultFailureEvents   = 10
+	// Chat messages have a size limit, so the logs of each container are cut down to the end.
+	maxFailureLogLength = 2000
+)
+
+func isFailureDetailsEnabled() bool {
+	return utils.GetEnvBool("KW_FAILURE_DETAILS_ENABLED", false)
+}
+
+// failureCollector gathers the logs of failed hooks and recent warning events when a release
+// fails, so the user can see why without running kubectl.
+type failureCollector struct {
+	clientset kubernetes.Interface
+	logLines  int64
+	maxEvents int
+}
+
+func newFailureCollector(client kubernetes.Interface) *failureCollector {
+	return &failureCollector{
+		clientset: client,
+		logLines:  int64(utils.GetEnvInt("KW_FAILURE_LOG_LINES", defaultFailureLogLines)),
+		maxEvents: utils.GetEnvInt("KW_FAILURE_EVENTS", defaultFailureEvents),
+	}
+}
+
+// collect attaches the details of a failure to the event. Errors are logged rather than
+// returned because the notification is still worth sending without the details.
+func (f *failureCollector) collect(releaseEvent *kwrelease.Event) {
+	if !releaseEvent.IsFailed() {
+		return
+	}
+
+	details := &kwrelease.FailureDetails{}
+	namespaces := map[string]bool{releaseEvent.GetNamespace(): true}
+
+	for hook, resources := range releaseEvent.GetFailedHooks() {
+		for _, resource := range resources {
+			namespaces[resource.Namespace] = true
+			details.HookLogs = append(details.HookLogs, f.getHookLogs(hook.Name, resource)...)
+		}
+	}
+	sort.Slice(details.HookLogs, func(i, j int) bool {
+		return details.HookLogs[i].Pod < details.HookLogs[j].Pod
+	})
+
+	if f.maxEvents > 0 {
+		since := releaseEvent.GetOperationStartedAt()
+		for namespace := range namespaces {
+			details.Events = append(details.Events, f.getWarningEvents(namespace, since)...)
+		}
+		sort.Slice(details.Events, func(i, j int) bool {
+			return details.Events[i].LastSeen.After(details.Events[j].LastSeen)
+		})
+		if len(details.Events) > f.maxEvents {
+			details.Events = details.Events[:f.maxEvents]
+		}
+	}
+
+	if len(details.HookLogs) > 0 || len(details.Events) > 0 {
+		releaseEvent.SetFailureDetails(details)
+	}
+}
+
+// getHookLogs returns the end of the logs of every container in the pods which a hook ran.
+func (f *failureCollector) getHookLogs(hookName string, resource *kwrelease.ManifestResource) []*kwrelease.PodLogs {
+	if f.logLines <= 0 {
+		return nil
+	}
+
+	var pods []api_v1.Pod
+	switch resource.Kind {
+	case "Pod":
+		pod, err := f.clientset.CoreV1().Pods(resource.Namespace).Get(resource.Name, meta_v1.GetOptions{})
+		if errors.IsNotFound(err) {
+			// The hook delete policy may have removed it already.
+			return nil
+		}
+		if err != nil {
+			log.Println("Error getting hook pod", resource.Namespace+"/"+resource.Name+":", err)
+			return nil
+		}
+		pods = append(pods, *pod)
+
+	case "Job":
+		list, err := f.clientset.CoreV1().Pods(resource.Namespace).List(meta_v1.ListOptions{
+			LabelSelector: "job-name=" + resource.Name,
+		})
+		if err != nil {
+			log.Println("Error listing pods of hook job", resource.Namespace+"/"+resource.Name+":", err)
+			return nil
+		}
+		pods = list.Items
+
+	default:
+		return nil
+	}
+
+	var podLogs []*kwrelease.PodLogs
+	for _, pod := range pods {
+		containers := append(append([]api_v1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+		for _, container := range containers {
+			raw, err := f.clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &api_v1.PodLogOptions{
+				Container: container.Name,
+				TailLines: &f.logLines,
+			}).DoRaw()
+			if err != nil {
+				log.Println("Error getting logs of container", container.Name, "in hook pod", pod.Namespace+"/"+pod.Name+":", err)
+				continue
+			}
+
+			logs := strings.TrimSpace(string(raw))
+			if logs == "" {
+				continue
+			}
+			podLogs = append(podLogs, &kwrelease.PodLogs{
+				Hook:      hookName,
+				Pod:       pod.Name,
+				Container: container.Name,
+				Logs:      kwrelease.TruncateText(kwrelease.GetRedactor().RedactText(logs), maxFailureLogLength),
+			})
+		}
+	}
+	return podLogs
+}
+
+// getWarningEvents returns the warnings in a namespace which were last seen after the
+// operation started.
+func (f *failureCollector) getWarningEvents(namespace string, since time.Time) []*kwrelease.KubernetesEvent {
+	list, err := f.clientset.CoreV1().Events(namespace).List(meta_v1.ListOptions{
+		FieldSelector: "type=" + api_v1.EventTypeWarning,
+	})
+	if err != nil {
+		log.Println("Error listing events in namespace", namespace+":", err)
+		return nil
+	}
+
+	var events []*kwrelease.KubernetesEvent
+	for _, event := range list.Items {
+		lastSeen := event.LastTimestamp.Time
+		if lastSeen.IsZero() {
+			lastSeen = event.EventTime.Time
+		}
+		if lastSeen.Before(since) {
+			continue
+		}
+
+		events = append(events, &kwrelease.KubernetesEvent{
+			Kind:     event.InvolvedObject.Kind,
+			Name:     event.InvolvedObject.Name,
+			Reason:   event.Reason,
+			Message:  kwrelease.GetRedactor().RedactText(event.Message),
+			Count:    event.Count,
+			LastSeen: lastSeen,
+		})
+	}
+	return events
+}
@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RoadieHQ/kubewise/utils"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// The API server closes watches after 5 to 10 minutes and the informer immediately lists or
+// watches again. A longer gap than this means the informer is wedged.
+const defaultWatchActivityTimeout = 15 * time.Minute
+
+// Sending a notification should take seconds. A worker which has been busy with one event for
+// longer than this is stuck.
+const defaultWorkerTimeout = 5 * time.Minute
+
+// watchActivity records when the informers last spoke to the API server.
+type watchActivity struct {
+	mutex    sync.Mutex
+	lastSeen time.Time
+}
+
+func newWatchActivity() *watchActivity {
+	return &watchActivity{lastSeen: time.Now()}
+}
+
+func (a *watchActivity) record() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.lastSeen = time.Now()
+}
+
+func (a *watchActivity) since() time.Duration {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return time.Since(a.lastSeen)
+}
+
+// wrap records activity on every successful list, every watch which is started and every
+// watch event which is received.
+func (a *watchActivity) wrap(listWatch *cache.ListWatch) *cache.ListWatch {
+	return &cache.ListWatch{
+		ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
+			object, err := listWatch.ListFunc(options)
+			if err == nil {
+				a.record()
+			}
+			return object, err
+		},
+		WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
+			watcher, err := listWatch.WatchFunc(options)
+			if err != nil {
+				return nil, err
+			}
+			a.record()
+			return watch.Filter(watcher, func(event watch.Event) (watch.Event, bool) {
+				a.record()
+				return event, true
+			}), nil
+		},
+	}
+}
+
+// workerActivity records when each worker started processing its current event. Zero means
+// the worker is idle, waiting for an event.
+type workerActivity struct {
+	busySince []int64
+}
+
+func newWorkerActivity(workers int) *workerActivity {
+	return &workerActivity{busySince: make([]int64, workers)}
+}
+
+func (a *workerActivity) start(worker int) {
+	atomic.StoreInt64(&a.busySince[worker], time.Now().UnixNano())
+}
+
+func (a *workerActivity) finish(worker int) {
+	atomic.StoreInt64(&a.busySince[worker], 0)
+}
+
+// longestBusy returns how long the slowest worker has been busy with its current event.
+func (a *workerActivity) longestBusy() time.Duration {
+	var longest time.Duration
+	for i := range a.busySince {
+		if since := atomic.LoadInt64(&a.busySince[i]); since != 0 {
+			if busy := time.Since(time.Unix(0, since)); busy > longest {
+				longest = busy
+			}
+		}
+	}
+	return longest
+}
+
+func (c *Controller) isRunning() bool {
+	select {
+	case <-c.startedCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// checkLiveness fails when the informers have stopped talking to the API server or a worker is
+// stuck.
+func (c *Controller) checkLiveness() error {
+	watchTimeout := utils.GetEnvDuration("KW_LIVENESS_WATCH_TIMEOUT", defaultWatchActivityTimeout)
+	if since := c.watchActivity.since(); since > watchTimeout {
+		return fmt.Errorf("no watch activity in %s for %s", c.cluster, since.Round(time.Second))
+	}
+
+	workerTimeout := utils.GetEnvDuration("KW_LIVENESS_WORKER_TIMEOUT", defaultWorkerTimeout)
+	if busy := c.workerActivity.longestBusy(); busy > workerTimeout {
+		return fmt.Errorf("worker for %s busy with one event for %s", c.cluster, busy.Round(time.Second))
+	}
+
+	return nil
+}
+
+// checkReadiness fails until the informer caches have synced.
+func (c *Controller) checkReadiness() error {
+	if !c.isRunning() {
+		return fmt.Errorf("controller for %s is starting", c.cluster)
+	}
+
+	if !c.HasSynced() {
+		return fmt.Errorf("informer caches for %s have not synced", c.cluster)
+	}
+
+	return nil
+}
+
+// healthz is the liveness check. It fails when the informers for any cluster have stopped
+// talking to the API server or a worker is stuck, so that Kubernetes restarts the pod.
+func (cc *clusterControllers) healthz(w http.ResponseWriter, r *http.Request) {
+	// Standby replicas don't run informers or workers.
+	if !cc.isRunning() {
+		fmt.Fprintln(w, "ok")
+		return
+	}
+
+	for _, c := range cc.controllers {
+		if err := c.checkLiveness(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	fmt.Fprintln(w, "ok")
+}
+
+// readyz is the readiness check. It passes once the informer caches for every cluster have
+// synced. Standby replicas are always ready because they are healthy and waiting to take over.
+func (cc *clusterControllers) readyz(w http.ResponseWriter, r *http.Request) {
+	if !cc.isRunning() {
+		if isLeaderElectionEnabled() {
+			fmt.Fprintln(w, "ok: standby")
+		} else {
+			http.Error(w, "controller is starting", http.StatusServiceUnavailable)
+		}
+		return
+	}
+
+	for _, c := range cc.controllers {
+		if err := c.checkReadiness(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	fmt.Fprintln(w, "ok")
+}
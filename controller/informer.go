@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"github.com/RoadieHQ/kubewise/kwrelease"
+	"github.com/RoadieHQ/kubewise/utils"
+
+	api_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Helm labels every release Secret and ConfigMap that it creates with owner=helm. Filtering on
+// it server side means that other secrets, such as TLS certificates and service account tokens,
+// are never sent to KubeWise or held in its cache.
+const helmOwnerLabelSelector = "owner=helm"
+
+// isMetadataOnly reports whether informers should cache only the metadata of release objects.
+// The encoded release is then fetched when an event is processed. This trades an extra API
+// request per event for a much smaller cache, because release payloads contain every rendered
+// template in the chart.
+func isMetadataOnly() bool {
+	return utils.GetEnvBool("KW_METADATA_ONLY", false)
+}
+
+// newReleaseInformer creates an informer over the objects which the given Helm storage
+// driver keeps releases in. When metadataClient is non-nil, only object metadata is cached.
+// Every list and watch is recorded in activity so that a wedged informer can be detected.
+func newReleaseInformer(client kubernetes.Interface, metadataClient metadata.Interface, driver string, namespace string, activity *watchActivity) cache.SharedIndexInformer {
+	var listWatch *cache.ListWatch
+	var objectType runtime.Object
+
+	if metadataClient != nil {
+		listWatch = newMetadataListWatch(metadataClient, driver, namespace)
+		objectType = &meta_v1.PartialObjectMetadata{}
+	} else if driver == kwrelease.DriverConfigMap {
+		listWatch = newConfigMapListWatch(client, namespace)
+		objectType = &api_v1.ConfigMap{}
+	} else {
+		listWatch = newSecretListWatch(client, namespace)
+		objectType = &api_v1.Secret{}
+	}
+
+	return cache.NewSharedIndexInformer(
+		activity.wrap(listWatch),
+		objectType,
+		0,
+		cache.Indexers{},
+	)
+}
+
+func newSecretListWatch(client kubernetes.Interface, namespace string) *cache.ListWatch {
+	return &cache.ListWatch{
+		ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = helmOwnerLabelSelector
+			return client.CoreV1().Secrets(namespace).List(options)
+		},
+		WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = helmOwnerLabelSelector
+			return client.CoreV1().Secrets(namespace).Watch(options)
+		},
+	}
+}
+
+func newConfigMapListWatch(client kubernetes.Interface, namespace string) *cache.ListWatch {
+	return &cache.ListWatch{
+		ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = helmOwnerLabelSelector
+			return client.CoreV1().ConfigMaps(namespace).List(options)
+		},
+		WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = helmOwnerLabelSelector
+			return client.CoreV1().ConfigMaps(namespace).Watch(options)
+		},
+	}
+}
+
+// newMetadataListWatch lists and watches *meta_v1.PartialObjectMetadata rather than full
+// Secrets or ConfigMaps.
+func newMetadataListWatch(client metadata.Interface, driver string, namespace string) *cache.ListWatch {
+	resource := api_v1.SchemeGroupVersion.WithResource("secrets")
+	if driver == kwrelease.DriverConfigMap {
+		resource = api_v1.SchemeGroupVersion.WithResource("configmaps")
+	}
+
+	return &cache.ListWatch{
+		ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = helmOwnerLabelSelector
+			return client.Resource(resource).Namespace(namespace).List(options)
+		},
+		WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = helmOwnerLabelSelector
+			return client.Resource(resource).Namespace(namespace).Watch(options)
+		},
+	}
+}
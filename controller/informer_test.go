@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/RoadieHQ/kubewise/kwrelease"
+	"helm.sh/helm/v3/pkg/chart"
+	rspb "helm.sh/helm/v3/pkg/release"
+	api_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/metadata"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	benchmarkReleases  = 50
+	benchmarkRevisions = 10
+	// benchmarkTemplates is the number of templates in each chart. Helm stores every template
+	// and the manifest rendered from them in each revision.
+	benchmarkTemplates = 20
+)
+
+// newBenchmarkRelease builds a release which is about the size of a typical application chart.
+func newBenchmarkRelease(name string, version int) *rspb.Release {
+	templates := []*chart.File{}
+	manifest := strings.Builder{}
+	for i := 0; i < benchmarkTemplates; i++ {
+		// Checksum annotations, which restart pods when their config changes, are common and
+		// do not compress well.
+		checksums := ""
+		for j := 0; j < 8; j++ {
+			checksums += fmt.Sprintf("        checksum/config-%d: %x\n", j, sha256.Sum256([]byte(fmt.Sprint(name, version, i, j))))
+		}
+
+		template := fmt.Sprintf(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Release.Name }}-component-%d
+  labels:
+    app.kubernetes.io/name: {{ .Chart.Name }}
+    app.kubernetes.io/instance: {{ .Release.Name }}
+spec:
+  replicas: {{ .Values.replicas }}
+  template:
+    metadata:
+      annotations:
+`+checksums+`    spec:
+      containers:
+        - name: component-%d
+          image: "{{ .Values.image.repository }}:{{ .Values.image.tag }}"
+          env:
+            - name: COMPONENT_ID
+              value: "%s-%d-%d"
+`, i, i, name, version, i)
+		templates = append(templates, &chart.File{Name: fmt.Sprintf("templates/component-%d.yaml", i), Data: []byte(template)})
+		manifest.WriteString("---\n# Source: " + name + fmt.Sprintf("/templates/component-%d.yaml\n", i))
+		manifest.WriteString(strings.NewReplacer("{{ .Release.Name }}", name, "{{ .Chart.Name }}", name).Replace(template))
+	}
+
+	return &rspb.Release{
+		Name:      name,
+		Namespace: testNamespace,
+		Version:   version,
+		Info:      &rspb.Info{Status: rspb.StatusSuperseded, Description: "Upgrade complete"},
+		Chart: &chart.Chart{
+			Metadata:  &chart.Metadata{Name: name, Version: fmt.Sprintf("1.%d.0", version)},
+			Templates: templates,
+			Values:    map[string]interface{}{"replicas": 2, "image": map[string]interface{}{"repository": name, "tag": "latest"}},
+		},
+		Config:   map[string]interface{}{"replicas": version},
+		Manifest: manifest.String(),
+	}
+}
+
+// newBenchmarkClients returns a clientset and a metadata client which both hold the same Helm
+// release secrets.
+func newBenchmarkClients(b *testing.B) (kubernetes.Interface, metadata.Interface) {
+	secrets := []k8sruntime.Object{}
+	partialObjects := []k8sruntime.Object{}
+
+	for i := 0; i < benchmarkReleases; i++ {
+		for version := 1; version <= benchmarkRevisions; version++ {
+			release := newBenchmarkRelease(fmt.Sprintf("release-%d", i), version)
+			data, err := kwrelease.EncodeRelease(release)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			objectMeta := meta_v1.ObjectMeta{
+				Name:      fmt.Sprintf("sh.helm.release.v1.%s.v%d", release.Name, version),
+				Namespace: testNamespace,
+				Labels: map[string]string{
+					"owner":   "helm",
+					"name":    release.Name,
+					"status":  release.Info.Status.String(),
+					"version": fmt.Sprint(version),
+				},
+			}
+			secrets = append(secrets, &api_v1.Secret{
+				ObjectMeta: objectMeta,
+				Type:       "helm.sh/release.v1",
+				Data:       map[string][]byte{"release": []byte(data)},
+			})
+			partialObjects = append(partialObjects, &meta_v1.PartialObjectMetadata{
+				TypeMeta:   meta_v1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+				ObjectMeta: objectMeta,
+			})
+		}
+	}
+
+	scheme := k8sruntime.NewScheme()
+	scheme.AddKnownTypeWithName(api_v1.SchemeGroupVersion.WithKind("Secret"), &meta_v1.PartialObjectMetadata{})
+	scheme.AddKnownTypeWithName(api_v1.SchemeGroupVersion.WithKind("SecretList"), &meta_v1.PartialObjectMetadataList{})
+
+	return fake.NewSimpleClientset(secrets...), metadatafake.NewSimpleMetadataClient(scheme, partialObjects...)
+}
+
+// benchmarkInformerCache fills an informer cache with every release secret and reports the
+// memory which the cache holds on to, alongside the allocations made while filling it.
+func benchmarkInformerCache(b *testing.B, metadataOnly bool) {
+	client, metadataClient := newBenchmarkClients(b)
+	if !metadataOnly {
+		metadataClient = nil
+	}
+
+	var retained uint64
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+
+		informer := newReleaseInformer(client, metadataClient, kwrelease.DriverSecret, "", newWatchActivity())
+		stopCh := make(chan struct{})
+		go informer.Run(stopCh)
+		if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
+			b.Fatal("informer cache did not sync")
+		}
+		if cached := len(informer.GetStore().List()); cached != benchmarkReleases*benchmarkRevisions {
+			b.Fatalf("expected %d cached objects, got %d", benchmarkReleases*benchmarkRevisions, cached)
+		}
+
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		if after.HeapAlloc > before.HeapAlloc {
+			retained += after.HeapAlloc - before.HeapAlloc
+		}
+
+		close(stopCh)
+		runtime.KeepAlive(informer)
+	}
+
+	b.ReportMetric(float64(retained)/float64(b.N), "cache-bytes/op")
+}
+
+// BenchmarkInformerCache compares the memory used by full and metadata-only informers, e.g.
+//
+//	go test ./controller -run '^$' -bench InformerCache
+func BenchmarkInformerCache(b *testing.B) {
+	b.Run("full", func(b *testing.B) {
+		benchmarkInformerCache(b, false)
+	})
+	b.Run("metadata-only", func(b *testing.B) {
+		benchmarkInformerCache(b, true)
+	})
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/RoadieHQ/kubewise/utils"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	leaseName = "kubewise"
+	// These are the same timings used by the core Kubernetes controllers. A standby replica
+	// will take over within leaseDuration of the leader disappearing without releasing the lease.
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+func isLeaderElectionEnabled() bool {
+	return utils.GetEnvBool("KW_LEADER_ELECTION_ENABLED", false)
+}
+
+// getLeaderElectionNamespace decides where the Lease object lives. It should be the namespace
+// that KubeWise is installed into so that every replica competes for the same Lease.
+func getLeaderElectionNamespace() string {
+	if value, ok := os.LookupEnv("KW_LEADER_ELECTION_NAMESPACE"); ok && value != "" {
+		return value
+	}
+	return utils.GetPodNamespace()
+}
+
+func getLeaderElectionIdentity() string {
+	// The hostname of a pod is its name, which is unique among the replicas of a Deployment.
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Fatalln("Unable to determine hostname for leader election identity:", err)
+	}
+	return hostname
+}
+
+// runWithLeaderElection blocks until releaseCh is closed. The run function is only called once
+// this replica has acquired the Lease. Only the leader watches Helm releases and sends
+// notifications. Standby replicas wait for the Lease to become available.
+//
+// Closing releaseCh releases the Lease. The caller must make sure that run has finished its
+// work first, otherwise a standby could take over while notifications are still being sent.
+func runWithLeaderElection(client kubernetes.Interface, releaseCh <-chan struct{}, run func()) {
+	identity := getLeaderElectionIdentity()
+	namespace := getLeaderElectionNamespace()
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: meta_v1.ObjectMeta{
+			Name:      leaseName,
+			Namespace: namespace,
+		},
+		Client: client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: identity,
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-releaseCh
+		cancel()
+	}()
+
+	log.Println("KubeWise waiting to acquire leader lease", namespace+"/"+leaseName, "as", identity)
+
+	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: leaseDuration,
+		RenewDeadline: renewDeadline,
+		RetryPeriod:   retryPeriod,
+		// Releasing the Lease on shutdown lets a standby take over immediately rather than
+		// waiting for the Lease to expire.
+		ReleaseOnCancel: true,
+		Name:            leaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				log.Println("KubeWise acquired leader lease as", identity)
+				run()
+			},
+			OnStoppedLeading: func() {
+				select {
+				case <-releaseCh:
+					log.Println("KubeWise released leader lease as", identity)
+				default:
+					// The informer and queue cannot be safely restarted in this process. Exit so that
+					// Kubernetes restarts the pod as a standby.
+					log.Fatalln("KubeWise lost leader lease as", identity)
+				}
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					log.Println("KubeWise leader is now", leader)
+				}
+			},
+		},
+	})
+}
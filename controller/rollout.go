@@ -0,0 +1,358 @@
+package controller
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/RoadieHQ/kubewise/kwrelease"
+	"github.com/RoadieHQ/kubewise/utils"
+	apps_v1 "k8s.io/api/apps/v1"
+	api_v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// Helm waits up to 5 minutes by default when --wait is used.
+	defaultRolloutWatchPeriod = 5 * time.Minute
+	rolloutPollInterval       = 10 * time.Second
+)
+
+// These reasons are part of a healthy pod starting up. They only explain an unhealthy rollout
+// when there is nothing else to go on.
+var startingReasons = map[string]bool{
+	"ContainerCreating": true,
+	"PodInitializing":   true,
+}
+
+func isRolloutWatchEnabled() bool {
+	return utils.GetEnvBool("KW_ROLLOUT_WATCH_ENABLED", false)
+}
+
+// rolloutWatcher follows the rollout of the workloads in a release once it has been deployed
+// and tells the user whether their pods came up.
+type rolloutWatcher struct {
+	clientset kubernetes.Interface
+	period    time.Duration
+	notify    func(*kwrelease.RolloutStatus)
+	mutex     sync.Mutex
+	// watches maps a release, e.g. namespace/name, to the channel which cancels the watch on
+	// its latest deploy.
+	watches map[string]chan struct{}
+	stopped bool
+}
+
+func newRolloutWatcher(client kubernetes.Interface, notify func(*kwrelease.RolloutStatus)) *rolloutWatcher {
+	return &rolloutWatcher{
+		clientset: client,
+		period:    utils.GetEnvDuration("KW_ROLLOUT_WATCH_PERIOD", defaultRolloutWatchPeriod),
+		notify:    notify,
+		watches:   make(map[string]chan struct{}),
+	}
+}
+
+// observe starts watching the rollout when a release is deployed. Any other event for the
+// release, such as the start of another upgrade, cancels the watch because its result would
+// no longer mean anything.
+func (w *rolloutWatcher) observe(releaseEvent *kwrelease.Event) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	key := releaseEvent.GetNamespace() + "/" + releaseEvent.GetAppName()
+	if cancelCh, ok := w.watches[key]; ok {
+		close(cancelCh)
+		delete(w.watches, key)
+	}
+
+	switch releaseEvent.GetAction() {
+	case kwrelease.ActionPostInstall, kwrelease.ActionPostUpgrade, kwrelease.ActionPostRollback, kwrelease.ActionPostReplace:
+	default:
+		return
+	}
+
+	workloads := releaseEvent.GetWorkloads()
+	if len(workloads) == 0 || w.stopped {
+		return
+	}
+
+	cancelCh := make(chan struct{})
+	w.watches[key] = cancelCh
+	go w.watch(key, releaseEvent, workloads, cancelCh)
+}
+
+// watch polls the workloads until they are all healthy, they have all either succeeded or
+// given up, or the watch period ends.
+func (w *rolloutWatcher) watch(key string, releaseEvent *kwrelease.Event, workloads []*kwrelease.ManifestResource, cancelCh chan struct{}) {
+	start := time.Now()
+	deadline := time.NewTimer(w.period)
+	defer deadline.Stop()
+	ticker := time.NewTicker(rolloutPollInterval)
+	defer ticker.Stop()
+
+	var statuses []*kwrelease.WorkloadStatus
+	for finished := false; !finished; {
+		var done bool
+		statuses, done = w.checkWorkloads(workloads)
+		if done {
+			break
+		}
+
+		select {
+		case <-cancelCh:
+			return
+		case <-deadline.C:
+			statuses, _ = w.checkWorkloads(workloads)
+			finished = true
+		case <-ticker.C:
+		}
+	}
+
+	w.mutex.Lock()
+	if w.watches[key] != cancelCh {
+		// The watch was cancelled while the workloads were being checked.
+		w.mutex.Unlock()
+		return
+	}
+	delete(w.watches, key)
+	w.mutex.Unlock()
+
+	for _, status := range statuses {
+		if !status.Healthy && status.Reason == "" {
+			status.Reason = w.findPodProblem(status)
+		}
+	}
+
+	rolloutStatus := &kwrelease.RolloutStatus{
+		Event:      releaseEvent,
+		Workloads:  statuses,
+		WatchedFor: time.Since(start),
+	}
+	log.Println("Rollout of release", key, "finished. Healthy:", rolloutStatus.IsHealthy())
+	w.notify(rolloutStatus)
+}
+
+// stop cancels every watch which is in progress.
+func (w *rolloutWatcher) stop() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.stopped = true
+	for key, cancelCh := range w.watches {
+		close(cancelCh)
+		delete(w.watches, key)
+	}
+}
+
+// checkWorkloads fetches the rollout status of every workload. It reports done when there is
+// no point waiting any longer, because each workload is either healthy or has given up.
+func (w *rolloutWatcher) checkWorkloads(workloads []*kwrelease.ManifestResource) ([]*kwrelease.WorkloadStatus, bool) {
+	statuses := make([]*kwrelease.WorkloadStatus, 0, len(workloads))
+	done := true
+
+	for _, workload := range workloads {
+		status, stalled := w.checkWorkload(workload)
+		statuses = append(statuses, status)
+		if !status.Healthy && !stalled {
+			done = false
+		}
+	}
+
+	return statuses, done
+}
+
+// checkWorkload applies the same rules as kubectl rollout status. A Deployment which has
+// exceeded its progress deadline is reported as stalled.
+func (w *rolloutWatcher) checkWorkload(workload *kwrelease.ManifestResource) (*kwrelease.WorkloadStatus, bool) {
+	status := &kwrelease.WorkloadStatus{
+		Kind:      workload.Kind,
+		Namespace: workload.Namespace,
+		Name:      workload.Name,
+	}
+	stalled := false
+
+	var err error
+	switch workload.Kind {
+	case "Deployment":
+		var deployment *apps_v1.Deployment
+		deployment, err = w.clientset.AppsV1().Deployments(workload.Namespace).Get(workload.Name, meta_v1.GetOptions{})
+		if err == nil {
+			stalled = checkDeployment(deployment, status)
+		}
+
+	case "StatefulSet":
+		var statefulSet *apps_v1.StatefulSet
+		statefulSet, err = w.clientset.AppsV1().StatefulSets(workload.Namespace).Get(workload.Name, meta_v1.GetOptions{})
+		if err == nil {
+			checkStatefulSet(statefulSet, status)
+		}
+
+	case "DaemonSet":
+		var daemonSet *apps_v1.DaemonSet
+		daemonSet, err = w.clientset.AppsV1().DaemonSets(workload.Namespace).Get(workload.Name, meta_v1.GetOptions{})
+		if err == nil {
+			checkDaemonSet(daemonSet, status)
+		}
+	}
+
+	if errors.IsNotFound(err) {
+		status.Reason = "not found"
+	} else if err != nil {
+		log.Println("Error fetching", workload.Kind, workload.Namespace+"/"+workload.Name+":", err)
+	}
+
+	return status, stalled
+}
+
+func checkDeployment(deployment *apps_v1.Deployment, status *kwrelease.WorkloadStatus) bool {
+	status.Desired = 1
+	if deployment.Spec.Replicas != nil {
+		status.Desired = *deployment.Spec.Replicas
+	}
+
+	status.Ready = deployment.Status.AvailableReplicas
+	if deployment.Status.UpdatedReplicas < status.Ready {
+		status.Ready = deployment.Status.UpdatedReplicas
+	}
+
+	status.Healthy = deployment.Generation <= deployment.Status.ObservedGeneration &&
+		deployment.Status.UpdatedReplicas >= status.Desired &&
+		deployment.Status.Replicas <= deployment.Status.UpdatedReplicas &&
+		deployment.Status.AvailableReplicas >= deployment.Status.UpdatedReplicas
+
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == apps_v1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded" {
+			return !status.Healthy
+		}
+	}
+	return false
+}
+
+func checkStatefulSet(statefulSet *apps_v1.StatefulSet, status *kwrelease.WorkloadStatus) {
+	status.Desired = 1
+	if statefulSet.Spec.Replicas != nil {
+		status.Desired = *statefulSet.Spec.Replicas
+	}
+	status.Ready = statefulSet.Status.ReadyReplicas
+
+	status.Healthy = statefulSet.Generation <= statefulSet.Status.ObservedGeneration &&
+		statefulSet.Status.ReadyReplicas >= status.Desired
+
+	// Pods are only replaced by the user when the OnDelete strategy is used.
+	if !status.Healthy || statefulSet.Spec.UpdateStrategy.Type != apps_v1.RollingUpdateStatefulSetStrategyType {
+		return
+	}
+
+	partition := int32(0)
+	if rollingUpdate := statefulSet.Spec.UpdateStrategy.RollingUpdate; rollingUpdate != nil && rollingUpdate.Partition != nil {
+		partition = *rollingUpdate.Partition
+	}
+
+	if partition > 0 {
+		status.Healthy = statefulSet.Status.UpdatedReplicas >= status.Desired-partition
+	} else {
+		status.Healthy = statefulSet.Status.UpdateRevision == statefulSet.Status.CurrentRevision
+	}
+}
+
+func checkDaemonSet(daemonSet *apps_v1.DaemonSet, status *kwrelease.WorkloadStatus) {
+	status.Desired = daemonSet.Status.DesiredNumberScheduled
+	status.Ready = daemonSet.Status.NumberAvailable
+
+	status.Healthy = daemonSet.Generation <= daemonSet.Status.ObservedGeneration &&
+		daemonSet.Status.UpdatedNumberScheduled >= status.Desired &&
+		daemonSet.Status.NumberAvailable >= status.Desired
+}
+
+// findPodProblem looks at the pods of an unhealthy workload for the most common reason that
+// they are not ready, e.g. ImagePullBackOff or CrashLoopBackOff.
+func (w *rolloutWatcher) findPodProblem(status *kwrelease.WorkloadStatus) string {
+	var selector *meta_v1.LabelSelector
+
+	switch status.Kind {
+	case "Deployment":
+		if deployment, err := w.clientset.AppsV1().Deployments(status.Namespace).Get(status.Name, meta_v1.GetOptions{}); err == nil {
+			selector = deployment.Spec.Selector
+		}
+	case "StatefulSet":
+		if statefulSet, err := w.clientset.AppsV1().StatefulSets(status.Namespace).Get(status.Name, meta_v1.GetOptions{}); err == nil {
+			selector = statefulSet.Spec.Selector
+		}
+	case "DaemonSet":
+		if daemonSet, err := w.clientset.AppsV1().DaemonSets(status.Namespace).Get(status.Name, meta_v1.GetOptions{}); err == nil {
+			selector = daemonSet.Spec.Selector
+		}
+	}
+
+	if selector == nil {
+		return ""
+	}
+
+	labelSelector, err := meta_v1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return ""
+	}
+
+	pods, err := w.clientset.CoreV1().Pods(status.Namespace).List(meta_v1.ListOptions{LabelSelector: labelSelector.String()})
+	if err != nil {
+		log.Println("Error listing pods for", status.Kind, status.Namespace+"/"+status.Name+":", err)
+		return ""
+	}
+
+	counts := make(map[string]int)
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp == nil {
+			for _, reason := range getPodProblems(&pod) {
+				counts[reason]++
+			}
+		}
+	}
+
+	return mostCommonReason(counts)
+}
+
+func getPodProblems(pod *api_v1.Pod) []string {
+	reasons := []string{}
+
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == api_v1.PodScheduled && condition.Status == api_v1.ConditionFalse && condition.Reason != "" {
+			reasons = append(reasons, condition.Reason)
+		}
+	}
+
+	for _, containerStatuses := range [][]api_v1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, containerStatus := range containerStatuses {
+			if waiting := containerStatus.State.Waiting; waiting != nil && waiting.Reason != "" {
+				reasons = append(reasons, waiting.Reason)
+			}
+		}
+	}
+
+	return reasons
+}
+
+// mostCommonReason prefers reasons which explain a failure over those which are part of a pod
+// starting up. Ties are broken alphabetically so that the result is stable.
+func mostCommonReason(counts map[string]int) string {
+	reasons := make([]string, 0, len(counts))
+	for reason := range counts {
+		reasons = append(reasons, reason)
+	}
+
+	sort.Slice(reasons, func(i, j int) bool {
+		if startingReasons[reasons[i]] != startingReasons[reasons[j]] {
+			return !startingReasons[reasons[i]]
+		}
+		if counts[reasons[i]] != counts[reasons[j]] {
+			return counts[reasons[i]] > counts[reasons[j]]
+		}
+		return reasons[i] < reasons[j]
+	})
+
+	if len(reasons) == 0 {
+		return ""
+	}
+	return reasons[0]
+}
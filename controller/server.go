@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const defaultHTTPAddress = ":8080"
+
+// getHTTPAddress returns the address for the health check and metrics server to listen on.
+// Setting KW_HTTP_ADDRESS to a blank string disables the server.
+func getHTTPAddress() string {
+	if value, ok := os.LookupEnv("KW_HTTP_ADDRESS"); ok {
+		return value
+	}
+	return defaultHTTPAddress
+}
+
+func (cc *clusterControllers) newHTTPServer(address string) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", cc.healthz)
+	mux.HandleFunc("/readyz", cc.readyz)
+	mux.Handle("/metrics", promhttp.Handler())
+
+	return &http.Server{
+		Addr:    address,
+		Handler: mux,
+	}
+}
+
+// startHTTPServer serves the health checks and metrics in the background. It returns nil if
+// the server is disabled.
+func (cc *clusterControllers) startHTTPServer() *http.Server {
+	address := getHTTPAddress()
+	if address == "" {
+		return nil
+	}
+
+	server := cc.newHTTPServer(address)
+	go func() {
+		log.Println("KubeWise serving health checks and metrics on", address)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalln("Error serving health checks and metrics on", address+":", err)
+		}
+	}()
+
+	return server
+}
+
+func stopHTTPServer(server *http.Server) {
+	if server == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Println("Error stopping HTTP server:", err)
+	}
+}
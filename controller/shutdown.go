@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"log"
+	"time"
+
+	"github.com/RoadieHQ/kubewise/utils"
+)
+
+// Kubernetes waits 30 seconds by default before killing a terminating pod. The grace period
+// should be shorter than that so that the leader lease is released cleanly.
+const defaultShutdownGracePeriod = 20 * time.Second
+
+func getShutdownGracePeriod() time.Duration {
+	return utils.GetEnvDuration("KW_SHUTDOWN_GRACE_PERIOD", defaultShutdownGracePeriod)
+}
+
+func isShutdownMessageEnabled() bool {
+	return utils.GetEnvBool("KW_SHUTDOWN_MESSAGE_ENABLED", false)
+}
+
+// queueLength returns the number of events which are waiting to be processed.
+func (c *Controller) queueLength() int {
+	length := 0
+	for _, queue := range c.queues {
+		length += queue.Len()
+	}
+	return length
+}
+
+// drain stops the workers once every queued event has been processed and every in-flight
+// notification has been delivered. It must only be called after the informers have stopped so
+// that no new events are queued.
+func (c *Controller) drain() {
+	log.Println("KubeWise draining", c.queueLength(), "queued events for", c.cluster)
+
+	// Queues which are shut down continue to hand out the events they hold. Workers only exit
+	// once their queue is empty.
+	for _, queue := range c.queues {
+		queue.ShutDown()
+	}
+	c.workers.Wait()
+
+	if c.stuckDetector != nil {
+		c.stuckDetector.stop()
+	}
+	if c.rolloutWatcher != nil {
+		c.rolloutWatcher.stop()
+	}
+	if c.driftDetector != nil {
+		c.driftDetector.stop()
+	}
+	if c.checkpoint != nil {
+		c.checkpoint.stop()
+	}
+
+	log.Println("KubeWise controller for", c.cluster, "stopped")
+}
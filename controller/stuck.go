@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/RoadieHQ/kubewise/kwrelease"
+	"github.com/RoadieHQ/kubewise/utils"
+	rspb "helm.sh/helm/v3/pkg/release"
+)
+
+// A Helm operation normally takes seconds or minutes, even with --wait. The default --timeout
+// for Helm is 5 minutes so a release which is pending for much longer than that is stuck.
+const (
+	defaultStuckAlertAfter    = 15 * time.Minute
+	defaultStuckAlertReminder = time.Hour
+)
+
+func isStuckAlertEnabled() bool {
+	return utils.GetEnvBool("KW_STUCK_ALERT_ENABLED", false)
+}
+
+// pendingRelease is a release which Helm is part way through an operation on.
+type pendingRelease struct {
+	stuck *kwrelease.StuckRelease
+	// timer fires when the alert or the next reminder is due.
+	timer   *time.Timer
+	alerted bool
+}
+
+// stuckDetector alerts the user when a release stays pending for longer than it should. A
+// reminder is sent periodically until the release settles, at which point the user is told
+// that it has been resolved.
+type stuckDetector struct {
+	mutex      sync.Mutex
+	alertAfter time.Duration
+	// reminder is how often to repeat the alert. Zero means the alert is only sent once.
+	reminder time.Duration
+	notify   func(*kwrelease.StuckRelease)
+	// pending maps a release, e.g. namespace/name, to the operation which is underway.
+	pending map[string]*pendingRelease
+	stopped bool
+}
+
+func newStuckDetector(notify func(*kwrelease.StuckRelease)) *stuckDetector {
+	return &stuckDetector{
+		alertAfter: utils.GetEnvDuration("KW_STUCK_ALERT_AFTER", defaultStuckAlertAfter),
+		reminder:   utils.GetEnvDuration("KW_STUCK_ALERT_REMINDER", defaultStuckAlertReminder),
+		notify:     notify,
+		pending:    make(map[string]*pendingRelease),
+	}
+}
+
+// observe starts timing a release when it becomes pending. Any later event for the release
+// means that the operation has finished, successfully or not. This includes the deletion which
+// completes an uninstall, which has the same revision and status as the uninstalling event.
+func (d *stuckDetector) observe(releaseEvent *kwrelease.Event) {
+	d.mutex.Lock()
+
+	key := releaseEvent.GetNamespace() + "/" + releaseEvent.GetAppName()
+	existing := d.pending[key]
+
+	if existing != nil && releaseEvent.IsPending() &&
+		existing.stuck.Event.GetRevision() == releaseEvent.GetRevision() &&
+		existing.stuck.Event.GetStatus() == releaseEvent.GetStatus() {
+		d.mutex.Unlock()
+		return
+	}
+
+	var resolved *kwrelease.StuckRelease
+	if existing != nil {
+		existing.timer.Stop()
+		delete(d.pending, key)
+
+		if existing.alerted {
+			resolved = &kwrelease.StuckRelease{
+				Event:        existing.stuck.Event,
+				PendingSince: existing.stuck.PendingSince,
+				Resolution:   releaseEvent,
+				ResolvedAt:   time.Now(),
+			}
+		}
+	}
+
+	if releaseEvent.IsPending() && !d.stopped {
+		p := &pendingRelease{
+			stuck: &kwrelease.StuckRelease{
+				Event:        releaseEvent,
+				PendingSince: releaseEvent.GetOperationStartedAt(),
+			},
+		}
+
+		// The operation may have started long before KubeWise saw it, e.g. while it was down.
+		wait := d.alertAfter - time.Since(p.stuck.PendingSince)
+		if wait < 0 {
+			wait = 0
+		}
+		p.timer = time.AfterFunc(wait, func() { d.alert(key, p) })
+		d.pending[key] = p
+	}
+
+	d.mutex.Unlock()
+
+	if resolved != nil {
+		log.Println("Release", key, "is no longer stuck. It is now", resolved.GetResolvedStatus())
+		d.notify(resolved)
+	}
+}
+
+// observeDeletion resolves a pending release when the revision which is pending is deleted.
+// People often delete it by hand to get rid of "another operation is in progress". Helm also
+// deletes old revisions to keep to --history-max, which does not settle the release.
+func (d *stuckDetector) observeDeletion(releaseEvent *kwrelease.Event) {
+	key := releaseEvent.GetNamespace() + "/" + releaseEvent.GetAppName()
+
+	d.mutex.Lock()
+	existing := d.pending[key]
+	d.mutex.Unlock()
+
+	if existing != nil && existing.stuck.Event.GetRevision() == releaseEvent.GetRevision() {
+		d.observe(releaseEvent)
+	}
+}
+
+func (d *stuckDetector) alert(key string, p *pendingRelease) {
+	d.mutex.Lock()
+
+	// The release settled while the timer was firing.
+	if d.pending[key] != p {
+		d.mutex.Unlock()
+		return
+	}
+
+	p.alerted = true
+	if d.reminder > 0 {
+		p.timer = time.AfterFunc(d.reminder, func() { d.alert(key, p) })
+	}
+
+	d.mutex.Unlock()
+
+	log.Println("Release", key, "has been", p.stuck.Event.GetStatus(), "for", p.stuck.GetPendingDuration())
+	d.notify(p.stuck)
+}
+
+// stop cancels every pending alert and reminder.
+func (d *stuckDetector) stop() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.stopped = true
+	for key, p := range d.pending {
+		p.timer.Stop()
+		delete(d.pending, key)
+	}
+}
+
+// watchPendingReleases starts timing the releases which were already pending when KubeWise
+// started. They may have been stuck for a long time.
+func (c *Controller) watchPendingReleases(releases []*rspb.Release) {
+	for _, release := range releases {
+		releaseEvent := kwrelease.NewEventFromRelease(c.cluster, "update", release)
+		if releaseEvent.IsPending() {
+			c.stuckDetector.observe(releaseEvent)
+		}
+	}
+}
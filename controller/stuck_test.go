@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/RoadieHQ/kubewise/kwrelease"
+	"github.com/RoadieHQ/kubewise/utils"
+	rspb "helm.sh/helm/v3/pkg/release"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func waitForStuckRelease(t *testing.T, handler *recordingHandler) *kwrelease.StuckRelease {
+	select {
+	case stuck := <-handler.stuckCh:
+		return stuck
+	case <-time.After(5 * time.Second):
+		t.Fatal("no stuck release alert was sent")
+		return nil
+	}
+}
+
+func TestDeletingPendingRevisionResolvesStuckRelease(t *testing.T) {
+	for name, value := range map[string]string{
+		"KW_STUCK_ALERT_ENABLED":  "true",
+		"KW_STUCK_ALERT_AFTER":    "10ms",
+		"KW_STUCK_ALERT_REMINDER": "0",
+	} {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+
+	client := fake.NewSimpleClientset()
+	handler := &recordingHandler{
+		actions: make(map[string][]kwrelease.Action),
+		stuckCh: make(chan *kwrelease.StuckRelease, 10),
+	}
+	c := newClusterController(utils.NewClusterWithClient("test", client), handler)
+
+	for _, release := range []*rspb.Release{
+		newTestRelease("app", 1, rspb.StatusDeployed),
+		newTestRelease("app", 2, rspb.StatusDeployed),
+	} {
+		if _, err := client.CoreV1().Secrets(testNamespace).Create(newTestReleaseSecret(t, release)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stopCh := make(chan struct{})
+	stoppedCh := make(chan struct{})
+	go func() {
+		defer close(stoppedCh)
+		c.run(stopCh)
+	}()
+	defer func() {
+		close(stopCh)
+		<-stoppedCh
+	}()
+
+	for !c.HasSynced() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	upgradeRelease(t, client, "app", rspb.StatusPendingUpgrade)
+	if stuck := waitForStuckRelease(t, handler); stuck.Resolution != nil {
+		t.Fatalf("expected an alert, got a resolution to %s", stuck.GetResolvedStatus())
+	}
+
+	// Pruning an old revision does not settle the release, but deleting the pending one does.
+	for _, name := range []string{"sh.helm.release.v1.app.v1", "sh.helm.release.v1.app.v2"} {
+		if err := client.CoreV1().Secrets(testNamespace).Delete(name, &meta_v1.DeleteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stuck := waitForStuckRelease(t, handler)
+	if stuck.Resolution == nil || stuck.Resolution.GetRevision() != 2 {
+		t.Fatalf("expected the deletion of revision 2 to resolve the alert, got %+v", stuck)
+	}
+	if status := stuck.GetResolvedStatus(); status != "deleted" {
+		t.Errorf("expected the release to be resolved as deleted, got %s", status)
+	}
+
+	c.stuckDetector.mutex.Lock()
+	defer c.stuckDetector.mutex.Unlock()
+	if len(c.stuckDetector.pending) != 0 {
+		t.Errorf("expected no pending releases, got %d", len(c.stuckDetector.pending))
+	}
+}
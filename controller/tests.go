@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/RoadieHQ/kubewise/kwrelease"
+	"github.com/RoadieHQ/kubewise/utils"
+)
+
+func isTestResultsEnabled() bool {
+	return utils.GetEnvBool("KW_TEST_RESULTS_ENABLED", false)
+}
+
+// testRunTracker notices when helm test has been run against a release. Helm records the
+// results by updating the release in place, without changing its revision or status, so the
+// update looks like a duplicate of the deploy to everything else in the controller.
+type testRunTracker struct {
+	mutex sync.Mutex
+	// last maps a release, e.g. namespace/name, to when the last reported test run completed.
+	last   map[string]time.Time
+	notify func(*kwrelease.TestRun)
+}
+
+func newTestRunTracker(notify func(*kwrelease.TestRun)) *testRunTracker {
+	return &testRunTracker{
+		last:   make(map[string]time.Time),
+		notify: notify,
+	}
+}
+
+// observe reports the results of a test run the first time they are seen.
+func (t *testRunTracker) observe(releaseEvent *kwrelease.Event) {
+	key := releaseEvent.GetNamespace() + "/" + releaseEvent.GetAppName()
+
+	if releaseEvent.GetAction() == kwrelease.ActionPostUninstall {
+		t.mutex.Lock()
+		delete(t.last, key)
+		t.mutex.Unlock()
+		return
+	}
+
+	testRun := releaseEvent.GetTestRun()
+	if testRun == nil {
+		return
+	}
+
+	completedAt := testRun.GetCompletedAt()
+	t.mutex.Lock()
+	if !t.last[key].Before(completedAt) {
+		t.mutex.Unlock()
+		return
+	}
+	t.last[key] = completedAt
+	t.mutex.Unlock()
+
+	log.Println("Tests of release", key, "revision", releaseEvent.GetRevision(), "finished. Successful:", testRun.IsSuccessful())
+	t.notify(testRun)
+}
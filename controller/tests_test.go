@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RoadieHQ/kubewise/kwrelease"
+	rspb "helm.sh/helm/v3/pkg/release"
+)
+
+func newTestHook(name string) *rspb.Hook {
+	return &rspb.Hook{Name: name, Kind: "Pod", Events: []rspb.HookEvent{rspb.HookTest}}
+}
+
+func TestTestRunTrackerWaitsForEveryHookToFinish(t *testing.T) {
+	testRuns := []*kwrelease.TestRun{}
+	tracker := newTestRunTracker(func(testRun *kwrelease.TestRun) {
+		testRuns = append(testRuns, testRun)
+	})
+
+	release := newTestRelease("app", 2, rspb.StatusDeployed)
+	connection, database := newTestHook("app-test-connection"), newTestHook("app-test-database")
+	release.Hooks = []*rspb.Hook{connection, database}
+	startedAt := release.Info.LastDeployed.Add(time.Minute)
+
+	observe := func() {
+		tracker.observe(kwrelease.NewEventFromRelease(nil, "update", release))
+	}
+
+	// Helm saves the release as each test hook starts.
+	connection.LastRun = rspb.HookExecution{StartedAt: startedAt, Phase: rspb.HookPhaseRunning}
+	observe()
+	connection.LastRun.Phase = rspb.HookPhaseSucceeded
+	connection.LastRun.CompletedAt = startedAt.Add(time.Second)
+	database.LastRun = rspb.HookExecution{StartedAt: connection.LastRun.CompletedAt, Phase: rspb.HookPhaseRunning}
+	observe()
+	if len(testRuns) != 0 {
+		t.Fatalf("expected running tests not to be reported, got %d test runs", len(testRuns))
+	}
+
+	// Helm saves the release again once the last test hook has finished.
+	database.LastRun.Phase = rspb.HookPhaseSucceeded
+	database.LastRun.CompletedAt = startedAt.Add(2 * time.Second)
+	observe()
+	observe()
+	if len(testRuns) != 1 {
+		t.Fatalf("expected the finished test run to be reported once, got %d test runs", len(testRuns))
+	}
+	if !testRuns[0].IsSuccessful() {
+		t.Error("expected the test run to be successful")
+	}
+
+	// Running the tests again is reported again.
+	connection.LastRun = rspb.HookExecution{
+		StartedAt:   startedAt.Add(time.Hour),
+		CompletedAt: startedAt.Add(time.Hour + time.Second),
+		Phase:       rspb.HookPhaseFailed,
+	}
+	observe()
+	if len(testRuns) != 2 || testRuns[1].IsSuccessful() {
+		t.Fatalf("expected a second, failed test run to be reported, got %d test runs", len(testRuns))
+	}
+}
@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"hash/fnv"
+	"log"
+	"regexp"
+	"time"
+
+	"github.com/RoadieHQ/kubewise/metrics"
+	"github.com/RoadieHQ/kubewise/utils"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Helm names release storage objects like sh.helm.release.v1.zookeeper.v3 where the final
+// segment is the revision.
+var releaseObjectNamePattern = regexp.MustCompile(`^sh\.helm\.release\.v1\.(.+)\.v\d+$`)
+
+// retryBackoff is how long to wait before the first retry of an event which failed. It doubles
+// with each retry.
+const retryBackoff = 100 * time.Millisecond
+
+// getWorkerCount returns the number of workers which process events concurrently. Events for
+// different releases are processed in parallel so one slow notification doesn't hold up the
+// others.
+func getWorkerCount() int {
+	workers := utils.GetEnvInt("KW_WORKERS", 1)
+	if workers < 1 {
+		return 1
+	}
+	return workers
+}
+
+// releaseKey strips the revision from the key of a release storage object. Every revision of
+// a release shares the same release key, e.g. zookeeper/zookeeper for
+// zookeeper/sh.helm.release.v1.zookeeper.v3.
+func releaseKey(key string) string {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return key
+	}
+	if matches := releaseObjectNamePattern.FindStringSubmatch(name); matches != nil {
+		return namespace + "/" + matches[1]
+	}
+	return key
+}
+
+// newQueues creates one queue per worker. Each queue is only ever processed by a single
+// worker.
+func newQueues(workers int) []workqueue.RateLimitingInterface {
+	queues := make([]workqueue.RateLimitingInterface, workers)
+	for i := range queues {
+		queues[i] = workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	}
+	return queues
+}
+
+// queueFor chooses the queue for an event. Every event for a release is sent to the same queue,
+// and so the same worker, so that they are processed in the order they occurred. For example,
+// PRE_UPGRADE is always handled before POST_UPGRADE.
+func (c *Controller) queueFor(newEvent Event) workqueue.RateLimitingInterface {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(releaseKey(newEvent.key)))
+	return c.queues[hash.Sum32()%uint32(len(c.queues))]
+}
+
+func (c *Controller) enqueue(newEvent Event) {
+	c.queueFor(newEvent).Add(newEvent)
+}
+
+// processItemWithRetries processes an event, retrying it up to maxRetries times if it fails.
+// The event is retried by the worker which holds it rather than being put back on the queue.
+// Requeueing it would let a later event for the same release, e.g. POST_UPGRADE, overtake one
+// which failed, e.g. PRE_UPGRADE. The other events in the queue wait while the event is retried.
+func (c *Controller) processItemWithRetries(newEvent Event) error {
+	backoff := retryBackoff
+	err := c.processItem(newEvent)
+	for retries := 0; err != nil && retries < maxRetries; retries++ {
+		log.Printf("Error processing %s (will retry in %s): %v", newEvent.key, backoff, err)
+		metrics.QueueRetries.Inc()
+		time.Sleep(backoff)
+		backoff *= 2
+		err = c.processItem(newEvent)
+	}
+	return err
+}
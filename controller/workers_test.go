@@ -0,0 +1,221 @@
+package controller
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RoadieHQ/kubewise/kwrelease"
+	"github.com/RoadieHQ/kubewise/utils"
+	"helm.sh/helm/v3/pkg/chart"
+	rspb "helm.sh/helm/v3/pkg/release"
+	helmtime "helm.sh/helm/v3/pkg/time"
+	api_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testNamespace = "default"
+
+// recordingHandler records the actions it is asked to handle for each release. Handling the
+// PRE_UPGRADE of blockedRelease closes blockedCh and then waits until unblockCh is closed.
+type recordingHandler struct {
+	mutex          sync.Mutex
+	actions        map[string][]kwrelease.Action
+	blockedRelease string
+	blockedCh      chan struct{}
+	unblockCh      chan struct{}
+	blockTimedOut  bool
+	// stuckCh receives stuck release alerts when it is set.
+	stuckCh chan *kwrelease.StuckRelease
+}
+
+func (h *recordingHandler) HandleEvent(releaseEvent *kwrelease.Event) {
+	if releaseEvent.GetAppName() == h.blockedRelease && releaseEvent.GetAction() == kwrelease.ActionPreUpgrade {
+		close(h.blockedCh)
+		select {
+		case <-h.unblockCh:
+		case <-time.After(5 * time.Second):
+			h.mutex.Lock()
+			h.blockTimedOut = true
+			h.mutex.Unlock()
+		}
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.actions[releaseEvent.GetAppName()] = append(h.actions[releaseEvent.GetAppName()], releaseEvent.GetAction())
+}
+
+func (h *recordingHandler) getActions(name string) []kwrelease.Action {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return append([]kwrelease.Action{}, h.actions[name]...)
+}
+
+func (h *recordingHandler) Init()                                                     {}
+func (h *recordingHandler) HandleServerStartup(clusters []*kwrelease.ClusterReleases) {}
+func (h *recordingHandler) HandleServerShutdown()                                     {}
+func (h *recordingHandler) HandleStuckRelease(stuck *kwrelease.StuckRelease) {
+	if h.stuckCh != nil {
+		h.stuckCh <- stuck
+	}
+}
+func (h *recordingHandler) HandleRolloutStatus(rollout *kwrelease.RolloutStatus) {}
+func (h *recordingHandler) HandleTestRun(testRun *kwrelease.TestRun)             {}
+func (h *recordingHandler) HandleReleaseDrift(drift *kwrelease.ReleaseDrift)     {}
+func (h *recordingHandler) HandleDigest(digest *kwrelease.Digest)                {}
+
+func newTestRelease(name string, version int, status rspb.Status) *rspb.Release {
+	return &rspb.Release{
+		Name:      name,
+		Namespace: testNamespace,
+		Version:   version,
+		Info: &rspb.Info{
+			Status:       status,
+			Description:  "Upgrade complete",
+			LastDeployed: helmtime.Now(),
+		},
+		Chart: &chart.Chart{
+			Metadata: &chart.Metadata{Name: name, Version: fmt.Sprintf("1.%d.0", version)},
+		},
+	}
+}
+
+func newTestReleaseSecret(t *testing.T, release *rspb.Release) *api_v1.Secret {
+	data, err := kwrelease.EncodeRelease(release)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &api_v1.Secret{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      fmt.Sprintf("sh.helm.release.v1.%s.v%d", release.Name, release.Version),
+			Namespace: release.Namespace,
+			Labels: map[string]string{
+				"owner":   "helm",
+				"name":    release.Name,
+				"status":  release.Info.Status.String(),
+				"version": fmt.Sprint(release.Version),
+			},
+		},
+		Type: "helm.sh/release.v1",
+		Data: map[string][]byte{"release": []byte(data)},
+	}
+}
+
+// upgradeRelease stores a release in the way Helm does during an upgrade. Revision 1 is
+// deployed and revision 2 is pending until it is marked as deployed.
+func upgradeRelease(t *testing.T, client kubernetes.Interface, name string, status rspb.Status) {
+	secret := newTestReleaseSecret(t, newTestRelease(name, 2, status))
+	if _, err := client.CoreV1().Secrets(testNamespace).Update(secret); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// findReleasesOnDifferentQueues returns the names of two releases whose events are processed
+// by different workers.
+func findReleasesOnDifferentQueues(c *Controller) (string, string) {
+	queueOf := func(name string) interface{} {
+		return c.queueFor(Event{key: testNamespace + "/sh.helm.release.v1." + name + ".v2"})
+	}
+	for i := 1; ; i++ {
+		other := fmt.Sprintf("release-%d", i)
+		if queueOf(other) != queueOf("release-0") {
+			return "release-0", other
+		}
+	}
+}
+
+func TestWorkersPreserveReleaseOrderAndRunReleasesInParallel(t *testing.T) {
+	os.Setenv("KW_WORKERS", "4")
+	defer os.Unsetenv("KW_WORKERS")
+
+	client := fake.NewSimpleClientset()
+	handler := &recordingHandler{
+		actions:   make(map[string][]kwrelease.Action),
+		blockedCh: make(chan struct{}),
+		unblockCh: make(chan struct{}),
+	}
+	c := newClusterController(utils.NewClusterWithClient("test", client), handler)
+	if len(c.queues) != 4 {
+		t.Fatalf("expected 4 queues, got %d", len(c.queues))
+	}
+
+	slow, fast := findReleasesOnDifferentQueues(c)
+	handler.blockedRelease = slow
+
+	// Releases which exist before KubeWise starts are not reported.
+	for _, name := range []string{slow, fast} {
+		for _, release := range []*rspb.Release{
+			newTestRelease(name, 1, rspb.StatusDeployed),
+			newTestRelease(name, 2, rspb.StatusPendingUpgrade),
+		} {
+			if _, err := client.CoreV1().Secrets(testNamespace).Create(newTestReleaseSecret(t, release)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	stopCh := make(chan struct{})
+	stoppedCh := make(chan struct{})
+	go func() {
+		defer close(stoppedCh)
+		c.run(stopCh)
+	}()
+	defer func() {
+		close(stopCh)
+		<-stoppedCh
+	}()
+
+	for !c.HasSynced() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The slow release is held in PRE_UPGRADE until the fast release has been fully handled.
+	// Its POST_UPGRADE is queued behind the PRE_UPGRADE and must not overtake it.
+	//
+	// Each update waits for the previous one to be picked up. The queue merges events for the
+	// same object which are waiting to be processed, and the worker reads the latest state.
+	upgradeRelease(t, client, slow, rspb.StatusPendingUpgrade)
+	select {
+	case <-handler.blockedCh:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s PRE_UPGRADE was not handled", slow)
+	}
+	upgradeRelease(t, client, slow, rspb.StatusDeployed)
+
+	upgradeRelease(t, client, fast, rspb.StatusPendingUpgrade)
+	waitForActions(t, handler, fast, []kwrelease.Action{kwrelease.ActionPreUpgrade})
+	upgradeRelease(t, client, fast, rspb.StatusDeployed)
+
+	expected := []kwrelease.Action{kwrelease.ActionPreUpgrade, kwrelease.ActionPostUpgrade}
+	waitForActions(t, handler, fast, expected)
+	if actions := handler.getActions(slow); len(actions) != 0 {
+		t.Fatalf("expected %s to be blocked in PRE_UPGRADE, but it handled %v", slow, actions)
+	}
+
+	close(handler.unblockCh)
+	waitForActions(t, handler, slow, expected)
+
+	if handler.blockTimedOut {
+		t.Fatal("events for different releases were not handled in parallel")
+	}
+}
+
+func waitForActions(t *testing.T, handler *recordingHandler, name string, expected []kwrelease.Action) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if len(handler.getActions(name)) >= len(expected) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	actions := handler.getActions(name)
+	if fmt.Sprint(actions) != fmt.Sprint(expected) {
+		t.Fatalf("expected %s to handle %v in order, got %v", name, expected, actions)
+	}
+}
@@ -3,17 +3,18 @@ module github.com/RoadieHQ/kubewise
 go 1.14
 
 require (
-  github.com/Azure/go-autorest v14.0.0+incompatible
+	github.com/Azure/go-autorest v14.0.0+incompatible // indirect
 	github.com/golang/groupcache v0.0.0-20190702054246-869f871628b6 // indirect
 	github.com/olekukonko/tablewriter v0.0.2
 	github.com/pmezard/go-difflib v1.0.0
+	github.com/prometheus/client_golang v1.5.1
 	github.com/slack-go/slack v0.6.3
 	golang.org/x/net v0.0.0-20200226121028-0de0cce0169b // indirect
-	golang.org/x/sys v0.0.0-20191220142924-d4481acd189f // indirect
 	golang.org/x/time v0.0.0-20191024005414-555d28b269f0 // indirect
 	google.golang.org/appengine v1.6.5 // indirect
 	helm.sh/helm/v3 v3.1.1
 	k8s.io/api v0.17.3
 	k8s.io/apimachinery v0.17.3
 	k8s.io/client-go v0.17.2
+	sigs.k8s.io/yaml v1.1.0
 )
@@ -3,14 +3,16 @@ package googlechat
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/RoadieHQ/kubewise/kwrelease"
+	"github.com/RoadieHQ/kubewise/metrics"
 	"github.com/RoadieHQ/kubewise/presenters"
-	"helm.sh/helm/v3/pkg/release"
 )
 
 // GoogleChat represents the ability to send notifications to Google Hangouts Chat.
@@ -40,8 +42,53 @@ func (g *GoogleChat) HandleEvent(releaseEvent *kwrelease.Event) {
 }
 
 // HandleServerStartup sends notifications when KubeWise starts up.
-func (g *GoogleChat) HandleServerStartup(releases []*release.Release) {
-	if msg := presenters.PrepareServerStartupMsg(releases); msg != "" {
+func (g *GoogleChat) HandleServerStartup(clusters []*kwrelease.ClusterReleases) {
+	if msg := presenters.PrepareServerStartupMsg(clusters); msg != "" {
+		makeRequest(g, msg)
+	}
+}
+
+// HandleServerShutdown sends notifications when KubeWise shuts down.
+func (g *GoogleChat) HandleServerShutdown() {
+	if msg := presenters.PrepareServerShutdownMsg(); msg != "" {
+		makeRequest(g, msg)
+	}
+}
+
+// HandleStuckRelease sends notifications when a release has been pending for too long and
+// again when it settles.
+func (g *GoogleChat) HandleStuckRelease(stuck *kwrelease.StuckRelease) {
+	if msg := presenters.PrepareStuckReleaseMsg(stuck); msg != "" {
+		makeRequest(g, msg)
+	}
+}
+
+// HandleRolloutStatus sends notifications once the workloads in a release have rolled out, or
+// failed to.
+func (g *GoogleChat) HandleRolloutStatus(rollout *kwrelease.RolloutStatus) {
+	if msg := presenters.PrepareRolloutStatusMsg(rollout); msg != "" {
+		makeRequest(g, msg)
+	}
+}
+
+// HandleTestRun sends notifications when helm test has been run against a release.
+func (g *GoogleChat) HandleTestRun(testRun *kwrelease.TestRun) {
+	if msg := presenters.PrepareTestRunMsg(testRun); msg != "" {
+		makeRequest(g, msg)
+	}
+}
+
+// HandleReleaseDrift sends notifications when objects in a release have been changed outside
+// Helm.
+func (g *GoogleChat) HandleReleaseDrift(drift *kwrelease.ReleaseDrift) {
+	if msg := presenters.PrepareReleaseDriftMsg(drift); msg != "" {
+		makeRequest(g, msg)
+	}
+}
+
+// HandleDigest sends the scheduled digest.
+func (g *GoogleChat) HandleDigest(digest *kwrelease.Digest) {
+	if msg := presenters.PrepareDigestMsg(digest); msg != "" {
 		makeRequest(g, msg)
 	}
 }
@@ -59,9 +106,11 @@ func makeRequest(g *GoogleChat, text string) []byte {
 	}
 
 	contentType := "application/json; charset=UTF-8"
+	start := time.Now()
 	resp, requestErr := http.Post(g.WebhookURL, contentType, bytes.NewBuffer(jsonValue))
 
 	if requestErr != nil {
+		metrics.ObserveNotification("googlechat", start, requestErr)
 		// Do NOT log the err. It contains the URL which contains sensitive authentication data.
 		// If this is to be logged in future, strip the sensitive data from the URL before logging.
 		log.Println("Error making request to Google Hangouts Chat")
@@ -69,6 +118,14 @@ func makeRequest(g *GoogleChat, text string) []byte {
 	}
 
 	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		metrics.ObserveNotification("googlechat", start, fmt.Errorf("unexpected status %d", resp.StatusCode))
+		log.Println("Error response received from Google Hangouts Chat. Response status:", resp.Status)
+	} else {
+		metrics.ObserveNotification("googlechat", start, nil)
+	}
+
 	responseBody, readBodyErr := ioutil.ReadAll(resp.Body)
 	if readBodyErr != nil {
 		// Do NOT log the err. It could contain the URL which contains sensitive authentication data.
@@ -19,18 +19,30 @@ Modifications made
  1. Pass around release.Release pointers rather than interfaces.
  2. Removed many handlers.
  3. Added the googlechat handler.
+ 4. Added HandleServerShutdown.
+ 5. HandleServerStartup receives the releases in each watched cluster.
+ 6. Added HandleStuckRelease.
+ 7. Added HandleRolloutStatus.
+ 8. Added HandleTestRun.
+ 9. Added HandleReleaseDrift.
+ 10. Added HandleDigest.
 */
 
 package handlers
 
 import (
 	"github.com/RoadieHQ/kubewise/kwrelease"
-	"helm.sh/helm/v3/pkg/release"
 )
 
 // Handler instances store configuration regarding the sinks which notifications can be sent to.
 type Handler interface {
 	Init()
 	HandleEvent(releaseEvent *kwrelease.Event)
-	HandleServerStartup(releases []*release.Release)
+	HandleServerStartup(clusters []*kwrelease.ClusterReleases)
+	HandleServerShutdown()
+	HandleStuckRelease(stuck *kwrelease.StuckRelease)
+	HandleRolloutStatus(rollout *kwrelease.RolloutStatus)
+	HandleTestRun(testRun *kwrelease.TestRun)
+	HandleReleaseDrift(drift *kwrelease.ReleaseDrift)
+	HandleDigest(digest *kwrelease.Digest)
 }
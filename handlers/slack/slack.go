@@ -4,11 +4,12 @@ import (
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/RoadieHQ/kubewise/kwrelease"
+	"github.com/RoadieHQ/kubewise/metrics"
 	"github.com/RoadieHQ/kubewise/presenters"
 	"github.com/slack-go/slack"
-	"helm.sh/helm/v3/pkg/release"
 )
 
 type Slack struct {
@@ -39,8 +40,44 @@ func (s *Slack) HandleEvent(releaseEvent *kwrelease.Event) {
 	}
 }
 
-func (s *Slack) HandleServerStartup(releases []*release.Release) {
-	if msg := presenters.PrepareServerStartupMsg(releases); msg != "" {
+func (s *Slack) HandleServerStartup(clusters []*kwrelease.ClusterReleases) {
+	if msg := presenters.PrepareServerStartupMsg(clusters); msg != "" {
+		sendMessage(s, msg)
+	}
+}
+
+func (s *Slack) HandleServerShutdown() {
+	if msg := presenters.PrepareServerShutdownMsg(); msg != "" {
+		sendMessage(s, msg)
+	}
+}
+
+func (s *Slack) HandleStuckRelease(stuck *kwrelease.StuckRelease) {
+	if msg := presenters.PrepareStuckReleaseMsg(stuck); msg != "" {
+		sendMessage(s, msg)
+	}
+}
+
+func (s *Slack) HandleRolloutStatus(rollout *kwrelease.RolloutStatus) {
+	if msg := presenters.PrepareRolloutStatusMsg(rollout); msg != "" {
+		sendMessage(s, msg)
+	}
+}
+
+func (s *Slack) HandleTestRun(testRun *kwrelease.TestRun) {
+	if msg := presenters.PrepareTestRunMsg(testRun); msg != "" {
+		sendMessage(s, msg)
+	}
+}
+
+func (s *Slack) HandleReleaseDrift(drift *kwrelease.ReleaseDrift) {
+	if msg := presenters.PrepareReleaseDriftMsg(drift); msg != "" {
+		sendMessage(s, msg)
+	}
+}
+
+func (s *Slack) HandleDigest(digest *kwrelease.Digest) {
+	if msg := presenters.PrepareDigestMsg(digest); msg != "" {
 		sendMessage(s, msg)
 	}
 }
@@ -50,7 +87,9 @@ func sendMessage(s *Slack, msg string) {
 	text := slack.MsgOptionText(msg, false)
 	asUser := slack.MsgOptionAsUser(true)
 
+	start := time.Now()
 	channelID, timestamp, err := api.PostMessage(s.Channel, text, asUser)
+	metrics.ObserveNotification("slack", start, err)
 
 	if err != nil {
 		log.Println(strings.ReplaceAll(err.Error(), s.Token, "<slack-api-token>"))
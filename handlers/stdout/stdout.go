@@ -0,0 +1,61 @@
+package stdout
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/RoadieHQ/kubewise/kwrelease"
+	"github.com/RoadieHQ/kubewise/presenters"
+)
+
+// Stdout prints the messages which would be sent to a chat application. It is useful with
+// kubewise replay when working on presenters and for trying KubeWise out.
+type Stdout struct {
+	Writer io.Writer
+}
+
+func (s *Stdout) Init() {
+	if s.Writer == nil {
+		s.Writer = os.Stdout
+	}
+}
+
+func (s *Stdout) HandleEvent(releaseEvent *kwrelease.Event) {
+	s.print(presenters.PrepareMsg(releaseEvent))
+}
+
+func (s *Stdout) HandleServerStartup(clusters []*kwrelease.ClusterReleases) {
+	s.print(presenters.PrepareServerStartupMsg(clusters))
+}
+
+func (s *Stdout) HandleServerShutdown() {
+	s.print(presenters.PrepareServerShutdownMsg())
+}
+
+func (s *Stdout) HandleStuckRelease(stuck *kwrelease.StuckRelease) {
+	s.print(presenters.PrepareStuckReleaseMsg(stuck))
+}
+
+func (s *Stdout) HandleRolloutStatus(rollout *kwrelease.RolloutStatus) {
+	s.print(presenters.PrepareRolloutStatusMsg(rollout))
+}
+
+func (s *Stdout) HandleTestRun(testRun *kwrelease.TestRun) {
+	s.print(presenters.PrepareTestRunMsg(testRun))
+}
+
+func (s *Stdout) HandleReleaseDrift(drift *kwrelease.ReleaseDrift) {
+	s.print(presenters.PrepareReleaseDriftMsg(drift))
+}
+
+func (s *Stdout) HandleDigest(digest *kwrelease.Digest) {
+	s.print(presenters.PrepareDigestMsg(digest))
+}
+
+func (s *Stdout) print(msg string) {
+	if msg == "" {
+		return
+	}
+	fmt.Fprintf(s.Writer, "%s\n\n", msg)
+}
@@ -3,13 +3,15 @@ package webhook
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/RoadieHQ/kubewise/kwrelease"
+	"github.com/RoadieHQ/kubewise/metrics"
 	"github.com/RoadieHQ/kubewise/presenters"
-	rspb "helm.sh/helm/v3/pkg/release"
 )
 
 // Webhook is capable of sending JSON objects to a HTTP(s) endpoint using any HTTP verb.
@@ -53,8 +55,8 @@ func (w *Webhook) HandleEvent(releaseEvent *kwrelease.Event) {
 }
 
 // HandleServerStartup sends notifications when KubeWise starts up.
-func (w *Webhook) HandleServerStartup(releases []*rspb.Release) {
-	existingReleases := presenters.ToExistingReleasesForJSON(releases)
+func (w *Webhook) HandleServerStartup(clusters []*kwrelease.ClusterReleases) {
+	existingReleases := presenters.ToExistingReleasesForJSON(clusters)
 	jsonStr, err := json.Marshal(existingReleases)
 
 	if err != nil {
@@ -66,6 +68,87 @@ func (w *Webhook) HandleServerStartup(releases []*rspb.Release) {
 	makeRequest(w, jsonStr)
 }
 
+// HandleServerShutdown sends notifications when KubeWise shuts down.
+func (w *Webhook) HandleServerShutdown() {
+	jsonStr, err := json.Marshal(presenters.ToServerShutdownForJSON())
+
+	if err != nil {
+		// The message should never contain any sensitive data so it's safe to log this err.
+		log.Println("Error encoding JSON in webhook event", err)
+		return
+	}
+
+	makeRequest(w, jsonStr)
+}
+
+// HandleStuckRelease sends notifications when a release has been pending for too long and
+// again when it settles.
+func (w *Webhook) HandleStuckRelease(stuck *kwrelease.StuckRelease) {
+	jsonStr, err := json.Marshal(presenters.ToStuckReleaseForJSON(stuck))
+
+	if err != nil {
+		// The message should never contain any sensitive data so it's safe to log this err.
+		log.Println("Error encoding JSON in webhook event", err)
+		return
+	}
+
+	makeRequest(w, jsonStr)
+}
+
+// HandleRolloutStatus sends notifications once the workloads in a release have rolled out, or
+// failed to.
+func (w *Webhook) HandleRolloutStatus(rollout *kwrelease.RolloutStatus) {
+	jsonStr, err := json.Marshal(presenters.ToRolloutStatusForJSON(rollout))
+
+	if err != nil {
+		// The message should never contain any sensitive data so it's safe to log this err.
+		log.Println("Error encoding JSON in webhook event", err)
+		return
+	}
+
+	makeRequest(w, jsonStr)
+}
+
+// HandleTestRun sends notifications when helm test has been run against a release.
+func (w *Webhook) HandleTestRun(testRun *kwrelease.TestRun) {
+	jsonStr, err := json.Marshal(presenters.ToTestRunForJSON(testRun))
+
+	if err != nil {
+		// The message should never contain any sensitive data so it's safe to log this err.
+		log.Println("Error encoding JSON in webhook event", err)
+		return
+	}
+
+	makeRequest(w, jsonStr)
+}
+
+// HandleReleaseDrift sends notifications when objects in a release have been changed outside
+// Helm.
+func (w *Webhook) HandleReleaseDrift(drift *kwrelease.ReleaseDrift) {
+	jsonStr, err := json.Marshal(presenters.ToReleaseDriftForJSON(drift))
+
+	if err != nil {
+		// The message should never contain any sensitive data so it's safe to log this err.
+		log.Println("Error encoding JSON in webhook event", err)
+		return
+	}
+
+	makeRequest(w, jsonStr)
+}
+
+// HandleDigest sends the scheduled digest.
+func (w *Webhook) HandleDigest(digest *kwrelease.Digest) {
+	jsonStr, err := json.Marshal(presenters.ToDigestForJSON(digest))
+
+	if err != nil {
+		// The message should never contain any sensitive data so it's safe to log this err.
+		log.Println("Error encoding JSON in webhook event", err)
+		return
+	}
+
+	makeRequest(w, jsonStr)
+}
+
 func makeRequest(w *Webhook, jsonStr []byte) {
 	client := &http.Client{}
 	req, reqErr := http.NewRequest(w.Method, w.URL, bytes.NewBuffer(jsonStr))
@@ -83,13 +166,24 @@ func makeRequest(w *Webhook, jsonStr []byte) {
 		req.Header.Add("Authorization", "Bearer "+value)
 	}
 
+	start := time.Now()
 	resp, respErr := client.Do(req)
 
 	if respErr != nil {
+		metrics.ObserveNotification("webhook", start, respErr)
 		// Do NOT print this error. Could leak Authorization header.
+		log.Println("Error making request in webhook event")
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		metrics.ObserveNotification("webhook", start, fmt.Errorf("unexpected status %d", resp.StatusCode))
 		log.Println("Error handling response to webhook event. Response status:", resp.Status)
 		return
 	}
 
+	metrics.ObserveNotification("webhook", start, nil)
+
 	log.Println("Successful response received from", w.Method, w.URL, ":", resp.StatusCode)
 }
@@ -19,6 +19,7 @@ const (
 	ActionPostReplace           Action = "POST_REPLACE"
 	ActionPostReplaceSuperseded Action = "POST_REPLACE-SUPERSEDED"
 	ActionPreUninstall          Action = "PRE_UNINSTALL"
+	ActionPostUninstall         Action = "POST_UNINSTALL"
 	ActionFailedInstall         Action = "FAILED_INSTALL"
 	ActionFailedReplace         Action = "FAILED_REPLACE"
 )
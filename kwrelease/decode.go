@@ -0,0 +1,91 @@
+package kwrelease
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"strconv"
+
+	"helm.sh/helm/v3/pkg/chart"
+	rspb "helm.sh/helm/v3/pkg/release"
+)
+
+var magicGzip = []byte{0x1f, 0x8b, 0x08}
+
+// DecodeRelease decodes the release payload stored by Helm in a release secret. It mirrors
+// driver.decodeRelease in the Helm codebase, which is private and cannot be called directly.
+//
+// Fetching the release through the Helm driver is preferred wherever possible. DecodeRelease
+// exists for the cases where the release can no longer be fetched, such as when the secret has
+// already been deleted from the cluster.
+func DecodeRelease(data string) (*rspb.Release, error) {
+	b, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Releases stored before Helm introduced compression are not gzipped.
+	if len(b) > 3 && bytes.Equal(b[0:3], magicGzip) {
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		b, err = ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var release rspb.Release
+	if err := json.Unmarshal(b, &release); err != nil {
+		return nil, err
+	}
+
+	return &release, nil
+}
+
+// EncodeRelease encodes a release in the same way as Helm does before storing it in a release
+// secret or ConfigMap. It mirrors driver.encodeRelease in the Helm codebase.
+func EncodeRelease(release *rspb.Release) (string, error) {
+	b, err := json.Marshal(release)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err = w.Write(b); err != nil {
+		return "", err
+	}
+	w.Close()
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// DecodeReleaseFromLabels rebuilds what little is known about a release from the labels which
+// Helm puts on its storage objects. It is a last resort for when only the metadata of a deleted
+// object is available. The chart and its versions are unknown.
+func DecodeReleaseFromLabels(namespace string, labels map[string]string) *rspb.Release {
+	revision, err := strconv.Atoi(labels["version"])
+	if err != nil {
+		log.Println("Error parsing release revision from labels:", labels["version"])
+	}
+
+	return &rspb.Release{
+		Name:      labels["name"],
+		Namespace: namespace,
+		Version:   revision,
+		Info: &rspb.Info{
+			Status: rspb.Status(labels["status"]),
+		},
+		Chart: &chart.Chart{
+			Metadata: &chart.Metadata{},
+		},
+	}
+}
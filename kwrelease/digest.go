@@ -0,0 +1,78 @@
+package kwrelease
+
+import (
+	"time"
+
+	rspb "helm.sh/helm/v3/pkg/release"
+)
+
+// ReleaseChange is a summary of an operation on a release which is kept for the next digest.
+// Events hold the whole release, including its templates, so they are too big to keep.
+type ReleaseChange struct {
+	Cluster              string
+	Namespace            string
+	Name                 string
+	Action               Action
+	ChartName            string
+	ChartVersion         string
+	PreviousChartVersion string
+	AppVersion           string
+	Revision             int
+	At                   time.Time
+}
+
+// NewReleaseChange summarises the operation which an event completed.
+func NewReleaseChange(e *Event, at time.Time) *ReleaseChange {
+	return &ReleaseChange{
+		Cluster:              e.GetClusterName(),
+		Namespace:            e.GetNamespace(),
+		Name:                 e.GetAppName(),
+		Action:               e.GetAction(),
+		ChartName:            e.GetChartName(),
+		ChartVersion:         e.GetChartVersion(),
+		PreviousChartVersion: e.GetReplacedChartVersion(),
+		AppVersion:           e.GetAppVersion(),
+		Revision:             e.GetRevision(),
+		At:                   at,
+	}
+}
+
+// Digest is a periodic summary of the releases which KubeWise watches.
+type Digest struct {
+	Since time.Time
+	Until time.Time
+	// Clusters holds the releases which are currently installed in each cluster.
+	Clusters []*ClusterReleases
+	// Changes are the installs, upgrades, rollbacks, failures and uninstalls since the last
+	// digest, oldest first.
+	Changes []*ReleaseChange
+	// DroppedChanges is the number of changes which were left out because there were too many.
+	DroppedChanges int
+}
+
+// GetUnhealthyReleases returns the releases in each cluster which are failed or which Helm is
+// part way through an operation on.
+func (d *Digest) GetUnhealthyReleases() []*ClusterReleases {
+	unhealthy := []*ClusterReleases{}
+	for _, cluster := range d.Clusters {
+		var releases []*rspb.Release
+		for _, release := range cluster.Releases {
+			if IsUnhealthyStatus(release.Info.Status) {
+				releases = append(releases, release)
+			}
+		}
+		if len(releases) > 0 {
+			unhealthy = append(unhealthy, &ClusterReleases{Cluster: cluster.Cluster, Releases: releases})
+		}
+	}
+	return unhealthy
+}
+
+// IsUnhealthyStatus reports whether a release with the status needs attention.
+func IsUnhealthyStatus(status rspb.Status) bool {
+	switch status {
+	case rspb.StatusFailed, rspb.StatusPendingInstall, rspb.StatusPendingUpgrade, rspb.StatusPendingRollback, rspb.StatusUninstalling:
+		return true
+	}
+	return false
+}
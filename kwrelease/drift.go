@@ -0,0 +1,202 @@
+package kwrelease
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Fields of the rendered object which are not compared with the live object. Kubernetes fills
+// in or rewrites all of these.
+var ignoredDriftFields = map[string]bool{
+	"apiVersion": true,
+	"kind":       true,
+	"status":     true,
+}
+
+// FieldDrift is a field of a Kubernetes object whose live value differs from the value which
+// Helm applied. Expected and Live are blank when the field is missing.
+type FieldDrift struct {
+	Path     string
+	Expected string
+	Live     string
+}
+
+// ResourceDrift is a Kubernetes object in a release which has been changed outside Helm.
+type ResourceDrift struct {
+	Kind      string
+	Namespace string
+	Name      string
+	// Missing is true when the object has been deleted.
+	Missing bool
+	Fields  []*FieldDrift
+}
+
+// ReleaseDrift holds the objects in a release which no longer match its manifest.
+type ReleaseDrift struct {
+	Event     *Event
+	Resources []*ResourceDrift
+	CheckedAt time.Time
+}
+
+// GetFieldCount returns the number of fields which have drifted. A missing object counts as a
+// single field.
+func (d *ReleaseDrift) GetFieldCount() int {
+	count := 0
+	for _, resource := range d.Resources {
+		if resource.Missing {
+			count++
+		}
+		count += len(resource.Fields)
+	}
+	return count
+}
+
+// GetFingerprint summarises the drift so that a repeat of the same drift can be recognised.
+func (d *ReleaseDrift) GetFingerprint() string {
+	var fingerprint strings.Builder
+	fmt.Fprintf(&fingerprint, "%d", d.Event.GetRevision())
+	for _, resource := range d.Resources {
+		fmt.Fprintf(&fingerprint, "\n%s/%s/%s %t", resource.Kind, resource.Namespace, resource.Name, resource.Missing)
+		for _, field := range resource.Fields {
+			fmt.Fprintf(&fingerprint, "\n%s=%s", field.Path, field.Live)
+		}
+	}
+	return fingerprint.String()
+}
+
+// FindDrift compares an object from a release manifest with the live object in the cluster.
+// Only the fields which the chart set are compared. Kubernetes adds defaults, status and
+// bookkeeping metadata to every object, none of which are drift. Fields whose path starts with
+// one of ignoredPaths, e.g. spec.replicas when a HorizontalPodAutoscaler is in use, are
+// skipped.
+func FindDrift(rendered *ManifestResource, live map[string]interface{}, ignoredPaths []string) []*FieldDrift {
+	drift := []*FieldDrift{}
+
+	for key, expected := range rendered.Object {
+		if ignoredDriftFields[key] {
+			continue
+		}
+
+		if key == "metadata" {
+			// Only labels and annotations are set by charts and kept as they are by Kubernetes.
+			expectedMetadata, _ := expected.(map[string]interface{})
+			liveMetadata, _ := live["metadata"].(map[string]interface{})
+			for _, field := range []string{"labels", "annotations"} {
+				if value, ok := expectedMetadata[field]; ok {
+					drift = append(drift, compareDriftValues("metadata."+field, value, liveMetadata[field])...)
+				}
+			}
+			continue
+		}
+
+		// The API server moves stringData into data when a Secret is written.
+		if rendered.Kind == "Secret" && key == "stringData" {
+			continue
+		}
+
+		drift = append(drift, compareDriftValues(key, expected, live[key])...)
+	}
+
+	filtered := drift[:0]
+	for _, field := range drift {
+		if !isIgnoredDriftPath(field.Path, ignoredPaths) {
+			filtered = append(filtered, field)
+		}
+	}
+	drift = filtered
+
+	sort.Slice(drift, func(i, j int) bool {
+		return drift[i].Path < drift[j].Path
+	})
+
+	// The values of Secrets must never leave the cluster.
+	if rendered.Kind == "Secret" {
+		for _, field := range drift {
+			field.Expected, field.Live = "***", "***"
+		}
+	}
+
+	return drift
+}
+
+func isIgnoredDriftPath(path string, ignoredPaths []string) bool {
+	for _, ignored := range ignoredPaths {
+		if path == ignored || strings.HasPrefix(path, ignored+".") || strings.HasPrefix(path, ignored+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+func compareDriftValues(path string, expected interface{}, live interface{}) []*FieldDrift {
+	// A null in a chart means that the field is left to Kubernetes.
+	if expected == nil {
+		return nil
+	}
+
+	switch expectedValue := expected.(type) {
+	case map[string]interface{}:
+		liveValue, ok := live.(map[string]interface{})
+		if !ok {
+			return []*FieldDrift{newFieldDrift(path, expected, live)}
+		}
+		drift := []*FieldDrift{}
+		for key, value := range expectedValue {
+			drift = append(drift, compareDriftValues(JoinPath(path, key), value, liveValue[key])...)
+		}
+		return drift
+
+	case []interface{}:
+		liveValue, ok := live.([]interface{})
+		if !ok || len(liveValue) != len(expectedValue) {
+			return []*FieldDrift{newFieldDrift(path, expected, live)}
+		}
+		drift := []*FieldDrift{}
+		for i, value := range expectedValue {
+			drift = append(drift, compareDriftValues(fmt.Sprintf("%s[%d]", path, i), value, liveValue[i])...)
+		}
+		return drift
+	}
+
+	if isSameScalar(expected, live) {
+		return nil
+	}
+	return []*FieldDrift{newFieldDrift(path, expected, live)}
+}
+
+// isSameScalar compares two values loosely. Numbers from a manifest are float64 while live
+// objects hold int64, and Kubernetes rewrites quantities into a canonical form, e.g. 0.5 CPUs
+// becomes 500m.
+func isSameScalar(expected interface{}, live interface{}) bool {
+	if live == nil {
+		return false
+	}
+
+	expectedString, liveString := fmt.Sprint(expected), fmt.Sprint(live)
+	if expectedString == liveString || reflect.DeepEqual(expected, live) {
+		return true
+	}
+
+	expectedQuantity, err := resource.ParseQuantity(expectedString)
+	if err != nil {
+		return false
+	}
+	liveQuantity, err := resource.ParseQuantity(liveString)
+	if err != nil {
+		return false
+	}
+	return expectedQuantity.Cmp(liveQuantity) == 0
+}
+
+func newFieldDrift(path string, expected interface{}, live interface{}) *FieldDrift {
+	return &FieldDrift{
+		Path:     path,
+		Expected: FormatValue(expected),
+		Live:     FormatValue(live),
+	}
+}
@@ -0,0 +1,56 @@
+package kwrelease
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"github.com/RoadieHQ/kubewise/utils"
+	helmdriver "helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Helm can store releases in Secrets (the default) or ConfigMaps. It is controlled by the
+// HELM_DRIVER environment variable on the machine running Helm. KubeWise can watch either or both.
+const (
+	DriverSecret    = "secret"
+	DriverConfigMap = "configmap"
+)
+
+// GetStorageDrivers returns the Helm storage drivers which KubeWise should watch. They are
+// configured with KW_HELM_DRIVER which may be secret, configmap or both.
+func GetStorageDrivers() []string {
+	value, ok := os.LookupEnv("KW_HELM_DRIVER")
+	if !ok || value == "" {
+		return []string{DriverSecret}
+	}
+
+	switch strings.ToLower(value) {
+	case DriverSecret, "secrets":
+		return []string{DriverSecret}
+	case DriverConfigMap, "configmaps":
+		return []string{DriverConfigMap}
+	case "both":
+		return []string{DriverSecret, DriverConfigMap}
+	}
+
+	log.Println("Invalid value passed for environment variable KW_HELM_DRIVER. Options are secret, configmap or both. Defaulting to secret.")
+	return []string{DriverSecret}
+}
+
+// clientFor returns the client for a cluster. A nil cluster is the cluster KubeWise runs in.
+func clientFor(cluster *utils.Cluster) kubernetes.Interface {
+	if cluster == nil {
+		return utils.GetClient()
+	}
+	return cluster.GetClient()
+}
+
+// newHelmDriver builds the Helm storage driver which reads releases from the given namespace.
+// Delegating to the Helm driver reduces the possibility of breaking changes.
+func newHelmDriver(kubeClient kubernetes.Interface, driver string, namespace string) helmdriver.Driver {
+	if driver == DriverConfigMap {
+		return helmdriver.NewConfigMaps(kubeClient.CoreV1().ConfigMaps(namespace))
+	}
+	return helmdriver.NewSecrets(kubeClient.CoreV1().Secrets(namespace))
+}
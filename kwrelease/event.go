@@ -5,7 +5,9 @@ import (
 	"log"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/RoadieHQ/kubewise/utils"
 	"github.com/pmezard/go-difflib/difflib"
 	"helm.sh/helm/v3/pkg/chartutil"
 	rspb "helm.sh/helm/v3/pkg/release"
@@ -22,28 +24,107 @@ import (
 type Event struct {
 	// Describes the action that happened to the secret in order to trigger this event. Events
 	// occur when secrets are created, updated or deleted. What was the action that led to this
-	// particular event.
-	SecretAction         string
-	CurrentReleaseSecret *api_v1.Secret
-	currentRelease       *rspb.Release
-	previousRelease      *rspb.Release
+	// particular event. ConfigMaps are treated in exactly the same way as secrets.
+	SecretAction string
+	// Only one of CurrentReleaseSecret and CurrentReleaseConfigMap is set. It depends on the
+	// storage driver which Helm used to store the release.
+	CurrentReleaseSecret    *api_v1.Secret
+	CurrentReleaseConfigMap *api_v1.ConfigMap
+	// Cluster is the cluster which the release is installed in. Nil means the cluster which
+	// KubeWise runs in.
+	Cluster         *utils.Cluster
+	currentRelease  *rspb.Release
+	previousRelease *rspb.Release
+	// replacedRelease is the revision which was deployed before this one. It is the same as
+	// previousRelease except for a rollback, which is compared with the revision it restores.
+	replacedRelease *rspb.Release
+	// duration is how long the operation which settled in this event took.
+	duration       time.Duration
+	failureDetails *FailureDetails
 }
 
 // Init pre-loads data for the event.
-// - Brand new installs will only have e.currentRelease.
-// - Upgrades, rollbacks and uninstalls will have e.currentRelease and e.previousRelease (unless
-//   they have been deleted by the user or something)
+//   - Brand new installs will only have e.currentRelease.
+//   - Upgrades, rollbacks and uninstalls will have e.currentRelease and e.previousRelease (unless
+//     they have been deleted by the user or something)
+//   - Deletions will only have e.currentRelease. It is decoded from the last known state of the
+//     deleted secret because the secret can no longer be fetched from the cluster.
 func (e *Event) Init() error {
+	if e.SecretAction == "delete" {
+		release, err := DecodeRelease(e.getReleaseData())
+		if err != nil {
+			log.Println("Error decoding deleted release", e.getStorageDriver(), "with name:", e.getReleaseObject().GetName())
+			return err
+		}
+		e.currentRelease = release
+		return nil
+	}
+
 	// Fetching the release from the secret store is unnecessary except for the fact that we need
 	// to decode it and the safest way to do that is to let the Helm lib do it. THe Helm code has
 	// a function called driver.decodeRelease but it is private and cannot be accessed directly.
 	// By Getting the release from the store we get it back decoded for us.
-	e.currentRelease = e.GetRelease(e.CurrentReleaseSecret.Name)
-	e.previousRelease = e.getPreviousRelease()
+	e.currentRelease = e.GetRelease(e.getReleaseObject().GetName())
+	if e.currentRelease == nil {
+		return fmt.Errorf("unable to load release %s", e.getReleaseObject().GetName())
+	}
+	e.previousRelease, e.replacedRelease = e.getPreviousReleases()
 
 	return nil
 }
 
+// getReleaseObject returns the Secret or ConfigMap which Helm used to store the release. It
+// returns nil for events which are not backed by a storage object.
+func (e *Event) getReleaseObject() meta_v1.Object {
+	if e.CurrentReleaseConfigMap != nil {
+		return e.CurrentReleaseConfigMap
+	}
+	if e.CurrentReleaseSecret != nil {
+		return e.CurrentReleaseSecret
+	}
+	return nil
+}
+
+func (e *Event) getStorageDriver() string {
+	if e.CurrentReleaseConfigMap != nil {
+		return DriverConfigMap
+	}
+	return DriverSecret
+}
+
+// getReleaseData returns the encoded release stored by Helm.
+func (e *Event) getReleaseData() string {
+	if e.CurrentReleaseConfigMap != nil {
+		return e.CurrentReleaseConfigMap.Data["release"]
+	}
+	return string(e.CurrentReleaseSecret.Data["release"])
+}
+
+// NewEventFromRelease creates an Event for a release which is no longer backed by a release
+// secret in the cluster. For example, a release which was uninstalled while KubeWise was not
+// running. The secret getters return zero values for these events.
+func NewEventFromRelease(cluster *utils.Cluster, secretAction string, release *rspb.Release) *Event {
+	return &Event{
+		SecretAction:   secretAction,
+		Cluster:        cluster,
+		currentRelease: release,
+	}
+}
+
+// GetClusterName returns the name of the cluster which the release is installed in. It is
+// blank when KubeWise watches a single cluster which has not been named.
+func (e *Event) GetClusterName() string {
+	if e.Cluster == nil {
+		return ""
+	}
+	return e.Cluster.Name
+}
+
+// GetCurrentRelease returns the decoded release which the event is about.
+func (e *Event) GetCurrentRelease() *rspb.Release {
+	return e.currentRelease
+}
+
 // GetAppName returns the name of the application being installed by the Helm chart.
 func (e *Event) GetAppName() string {
 	return e.currentRelease.Name
@@ -88,21 +169,31 @@ func (e *Event) GetNotes() string {
 // GetSecretUID returns the UID of the release secret. Note that it returns a custom struct
 // which is defined in the Kubernetes library. It's not a string or suchlike.
 func (e *Event) GetSecretUID() kbtypes.UID {
-	return e.CurrentReleaseSecret.GetUID()
+	if e.getReleaseObject() == nil {
+		return ""
+	}
+	return e.getReleaseObject().GetUID()
 }
 
 // GetSecretCreationTimestamp returns the time that the release secret was created by Helm.
 // Note that it returns a custom Time object which is defined in the Kubernetes meta_v1 API. It's
 // not an instance of the standard go Time struct.
 func (e *Event) GetSecretCreationTimestamp() meta_v1.Time {
-	return e.CurrentReleaseSecret.GetCreationTimestamp()
+	if e.getReleaseObject() == nil {
+		return meta_v1.Time{}
+	}
+	return e.getReleaseObject().GetCreationTimestamp()
 }
 
 // GetLabelsModifiedAtTimestamp returns the modifiedAt time in the release Meta. It's stored in the
 // release as an Int and thus must be converted to a meta_v1.Time so it can be more easily
 // compared with the creation timestamp.
 func (e *Event) GetLabelsModifiedAtTimestamp() meta_v1.Time {
-	labels := e.CurrentReleaseSecret.GetObjectMeta().GetLabels()
+	if e.getReleaseObject() == nil {
+		return meta_v1.Time{}
+	}
+
+	labels := e.getReleaseObject().GetLabels()
 
 	// This has happened in regular use.
 	if labels["modifiedAt"] == "" {
@@ -118,6 +209,74 @@ func (e *Event) GetLabelsModifiedAtTimestamp() meta_v1.Time {
 	return meta_v1.Unix(i, 0)
 }
 
+// GetRevision returns the revision number of the release. Helm increments it every time the
+// release is upgraded or rolled back.
+func (e *Event) GetRevision() int {
+	return e.currentRelease.Version
+}
+
+// GetPreviousRevision returns the revision which the current revision is compared with. It is
+// zero when there is no previous revision, e.g. for an install.
+func (e *Event) GetPreviousRevision() int {
+	if e.previousRelease != nil {
+		return e.previousRelease.Version
+	}
+	return 0
+}
+
+// GetReplacedRevision returns the revision which was deployed before this one, e.g. the revision
+// which a rollback moved away from. It is zero for a new install.
+func (e *Event) GetReplacedRevision() int {
+	if e.replacedRelease != nil {
+		return e.replacedRelease.Version
+	}
+	return 0
+}
+
+// GetReplacedChartVersion returns the chart version of the revision which was deployed before
+// this one.
+func (e *Event) GetReplacedChartVersion() string {
+	if e.replacedRelease != nil {
+		return e.replacedRelease.Chart.Metadata.Version
+	}
+	return ""
+}
+
+// GetReplacedAppVersion returns the app version of the revision which was deployed before this
+// one.
+func (e *Event) GetReplacedAppVersion() string {
+	if e.replacedRelease != nil {
+		return e.replacedRelease.Chart.AppVersion()
+	}
+	return ""
+}
+
+// GetRollbackRevision returns the revision which a rollback restores. Helm records it in the
+// description of the new revision, e.g. "Rollback to 3". It is zero for other operations.
+func (e *Event) GetRollbackRevision() int {
+	description := e.currentRelease.Info.Description
+	if !strings.HasPrefix(description, "Rollback to ") {
+		return 0
+	}
+
+	revision, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(description, "Rollback to ")))
+	if err != nil {
+		return 0
+	}
+	return revision
+}
+
+// GetStatus returns the status of the release as recorded by Helm, e.g. deployed or failed.
+func (e *Event) GetStatus() rspb.Status {
+	return e.currentRelease.Info.Status
+}
+
+// GetChartName returns the name of the Helm chart being installed. This is often, but not
+// always, the same as the name of the application.
+func (e *Event) GetChartName() string {
+	return e.currentRelease.Chart.Metadata.Name
+}
+
 // GetChartVersion returns the version of the Helm chart being installed. This is different than
 // the version of the application being installed. The same application version may span multiple
 // chart versions.
@@ -141,10 +300,11 @@ func (e *Event) IsAppVersionChanged() bool {
 }
 
 // GetConfigDiffYAML is useful to show what has changed during a chart upgrade or rollback. It
-// will show a diff of the values file in the Slack message or other notification. Be careful
-// with secrets.
+// will show a diff of the values file in the Slack message or other notification. Sensitive
+// values are redacted by the Redactor before the diff is computed, but be careful with secrets.
 func (e *Event) GetConfigDiffYAML() string {
-	currentReleaseConfigYAML, err := chartutil.Values(e.currentRelease.Config).YAML()
+	redactor := GetRedactor()
+	currentReleaseConfigYAML, err := chartutil.Values(redactor.RedactValues(e.currentRelease.Config)).YAML()
 
 	if err != nil {
 		// Do NOT log the values. Could leak sensitive data.
@@ -156,7 +316,7 @@ func (e *Event) GetConfigDiffYAML() string {
 		return fmt.Sprintf("%s\n", currentReleaseConfigYAML)
 	}
 
-	previousReleaseConfigYAML, err := chartutil.Values(e.previousRelease.Config).YAML()
+	previousReleaseConfigYAML, err := chartutil.Values(redactor.RedactValues(e.previousRelease.Config)).YAML()
 
 	if err != nil {
 		// Do NOT log the values. Could leak sensitive data.
@@ -182,9 +342,40 @@ func (e *Event) GetConfigDiffYAML() string {
 	return diffText
 }
 
+// GetConfigDiff compares the values supplied by the user for the previous revision with those
+// for the current revision. Changes are reported by path, e.g. image.tag, so reordered keys are
+// not reported. Every value is reported as added when there is no previous revision. Sensitive
+// values are redacted by the Redactor before they are compared.
+func (e *Event) GetConfigDiff() []*ValueChange {
+	redactor := GetRedactor()
+
+	previousConfig := map[string]interface{}{}
+	if e.previousRelease != nil && e.previousRelease.Config != nil {
+		previousConfig = redactor.RedactValues(e.previousRelease.Config)
+	}
+	currentConfig := map[string]interface{}{}
+	if e.currentRelease.Config != nil {
+		currentConfig = redactor.RedactValues(e.currentRelease.Config)
+	}
+
+	return DiffValues(previousConfig, currentConfig)
+}
+
 // GetAction returns the action which is being performed in this Event. It may be an install,
 // upgrade or other Event.
 func (e *Event) GetAction() Action {
+	if e.SecretAction == "delete" {
+		// Helm deletes the secrets for every revision of a release when it is uninstalled. The
+		// secret for the latest revision is the only one which is marked as uninstalling. The other
+		// deletions are historical revisions being purged, either by an uninstall or because of
+		// --history-max.
+		if e.currentRelease.Info.Status == rspb.StatusUninstalling ||
+			e.currentRelease.Info.Status == rspb.StatusUninstalled {
+			return ActionPostUninstall
+		}
+		return ActionPostReplaceSuperseded
+	}
+
 	if e.currentRelease.Info.Status == rspb.StatusPendingInstall {
 		return ActionPreInstall
 	} else if e.currentRelease.Info.Status == rspb.StatusPendingUpgrade {
@@ -208,6 +399,21 @@ func (e *Event) GetAction() Action {
 		return ActionFailedReplace
 	} else if e.currentRelease.Info.Status == rspb.StatusSuperseded {
 		return ActionPostReplaceSuperseded
+	} else if e.currentRelease.Info.Status == rspb.StatusUninstalled {
+		// Helm only keeps an uninstalled release around when --keep-history is used.
+		return ActionPostUninstall
 	}
 	return ActionPreUninstall
 }
+
+// SetDuration records how long the operation which settled in this event took. It is set by
+// the controller, which saw the operation start.
+func (e *Event) SetDuration(duration time.Duration) {
+	e.duration = duration
+}
+
+// GetDuration returns how long the install, upgrade, rollback or uninstall took. It is zero
+// when the start of the operation was not seen, or the operation has not finished.
+func (e *Event) GetDuration() time.Duration {
+	return e.duration
+}
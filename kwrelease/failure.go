@@ -0,0 +1,79 @@
+package kwrelease
+
+import (
+	"strings"
+	"time"
+
+	rspb "helm.sh/helm/v3/pkg/release"
+)
+
+// TruncateText keeps the end of text which is longer than maxLength. The end of a log is
+// usually where the error is.
+func TruncateText(text string, maxLength int) string {
+	if maxLength <= 0 || len(text) <= maxLength {
+		return text
+	}
+
+	text = text[len(text)-maxLength:]
+	// Don't start part way through a line, or a multi-byte character.
+	if index := strings.Index(text, "\n"); index >= 0 && index < len(text)-1 {
+		text = text[index+1:]
+	}
+	return "…\n" + strings.ToValidUTF8(text, "")
+}
+
+// PodLogs is the tail of the logs of a container in a hook Pod.
+type PodLogs struct {
+	Hook      string
+	Pod       string
+	Container string
+	Logs      string
+}
+
+// KubernetesEvent is a core/v1 Event which may explain why a release failed, e.g. a BackOff
+// or FailedScheduling warning.
+type KubernetesEvent struct {
+	Kind     string
+	Name     string
+	Reason   string
+	Message  string
+	Count    int32
+	LastSeen time.Time
+}
+
+// FailureDetails are collected from the cluster when a release fails. They explain the failure
+// in more detail than the release description, which is often just the name of the hook which
+// failed.
+type FailureDetails struct {
+	HookLogs []*PodLogs
+	Events   []*KubernetesEvent
+}
+
+// SetFailureDetails attaches the details of a failure to the event. They are collected by the
+// controller, which has access to the cluster.
+func (e *Event) SetFailureDetails(details *FailureDetails) {
+	e.failureDetails = details
+}
+
+// GetFailureDetails returns the details of a failure. It is nil unless they were collected.
+func (e *Event) GetFailureDetails() *FailureDetails {
+	return e.failureDetails
+}
+
+// IsFailed reports whether the release failed to install, upgrade or roll back.
+func (e *Event) IsFailed() bool {
+	action := e.GetAction()
+	return action == ActionFailedInstall || action == ActionFailedReplace
+}
+
+// GetFailedHooks returns the hooks which failed the last time they ran, e.g. a pre-upgrade Job
+// which runs database migrations. Each is returned along with the resources in its manifest.
+func (e *Event) GetFailedHooks() map[*rspb.Hook][]*ManifestResource {
+	failed := make(map[*rspb.Hook][]*ManifestResource)
+	for _, hook := range e.currentRelease.Hooks {
+		if hook != nil && hook.LastRun.Phase == rspb.HookPhaseFailed {
+			failed[hook] = ParseManifest(hook.Manifest, e.GetNamespace())
+		}
+	}
+	return failed
+}
@@ -3,13 +3,12 @@ package kwrelease
 import (
 	"fmt"
 	"log"
-	"os"
 	"strconv"
 	"strings"
 
 	"github.com/RoadieHQ/kubewise/utils"
 	rspb "helm.sh/helm/v3/pkg/release"
-	helmdriver "helm.sh/helm/v3/pkg/storage/driver"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func inferNameOfPreviousReleaseSecret(currentReleaseSecretName string) string {
@@ -36,12 +35,12 @@ func inferNameOfPreviousReleaseSecret(currentReleaseSecretName string) string {
 	return strings.Join(previousReleaseVersion, ".")
 }
 
-// GetRelease retrieves a release object from the Kubernetes Secret store. It delegates to
-// the Helm Driver for this operation in order to reduce the possibility of breaking changes.
+// GetRelease retrieves a release object from the Kubernetes Secret or ConfigMap store, whichever
+// the current release is stored in. It delegates to the Helm Driver for this operation in order
+// to reduce the possibility of breaking changes.
 func (e *Event) GetRelease(secretName string) *rspb.Release {
-	kubeClient := utils.GetClient()
-	secrets := helmdriver.NewSecrets(kubeClient.CoreV1().Secrets(e.CurrentReleaseSecret.Namespace))
-	result, err := secrets.Get(secretName)
+	store := newHelmDriver(clientFor(e.Cluster), e.getStorageDriver(), e.getReleaseObject().GetNamespace())
+	result, err := store.Get(secretName)
 
 	if err != nil {
 		log.Println("Error finding release secret with name:", secretName)
@@ -51,16 +50,65 @@ func (e *Event) GetRelease(secretName string) *rspb.Release {
 	return result
 }
 
-// GetPreviousRelease locates previous Helm releases based off the name of a given secret.
-// Helm 3 releases have secret names like: sh.helm.release.v1.zookeeper.v1
-// The last `v1` is incremented every time an upgrade occurs. This way, the previous releases
-// of a package can be located by looking for secrets with matching names.
+// getPreviousReleases finds the revision which the current revision is compared with, e.g. to
+// tell the user which version is being upgraded from, and the revision which it replaces. They
+// are chosen from the history of the release, which is found through the name and owner=helm
+// labels which Helm puts on every revision:
+//   - The current revision replaces the last revision which was successfully deployed. Failed
+//     and pending revisions are skipped.
+//   - A rollback is compared with the revision which it restores, e.g. revision 3 for
+//     "Rollback to 3". Anything else is compared with the revision which it replaces.
 //
-// When Helm upgrades a package, it leaves secrets from the previous releases in the cluster. They
-// can be located and used to determine if the current operation is an install or an upgrade. It
-// is also useful to inform the user of the appVersion being upgraded from.
-func (e *Event) getPreviousRelease() *rspb.Release {
-	previousReleaseSecretName := inferNameOfPreviousReleaseSecret(e.CurrentReleaseSecret.Name)
+// Revision N-1 may have been pruned by --history-max, so it can not simply be assumed to exist.
+// A rollback whose target has been pruned is compared with the revision it replaces instead.
+// When the history can not be queried, both are found by name.
+//
+// The previous release is also used to determine if the current operation is an install or an
+// upgrade.
+func (e *Event) getPreviousReleases() (previous *rspb.Release, replaced *rspb.Release) {
+	if e.currentRelease.Version <= 1 {
+		return nil, nil
+	}
+
+	store := newHelmDriver(clientFor(e.Cluster), e.getStorageDriver(), e.getReleaseObject().GetNamespace())
+	history, err := store.Query(map[string]string{"name": e.currentRelease.Name, "owner": "helm"})
+	if err != nil {
+		log.Println("Error querying the history of release", e.GetAppName()+". Finding the previous release by name instead:", err)
+		previous = e.getPreviousReleaseByName()
+		return previous, previous
+	}
+
+	for _, release := range history {
+		if release.Version >= e.currentRelease.Version || release.Info == nil {
+			continue
+		}
+		if replaced != nil && release.Version < replaced.Version {
+			continue
+		}
+
+		switch release.Info.Status {
+		case rspb.StatusDeployed, rspb.StatusSuperseded:
+			replaced = release
+		}
+	}
+
+	if rollbackRevision := e.GetRollbackRevision(); rollbackRevision > 0 {
+		for _, release := range history {
+			if release.Version == rollbackRevision {
+				return release, replaced
+			}
+		}
+		log.Println("Revision", rollbackRevision, "of release", e.GetAppName(), "which was rolled back to is no longer in its history")
+	}
+
+	return replaced, replaced
+}
+
+// getPreviousReleaseByName locates the previous Helm release based off the name of a given
+// secret. Helm 3 releases have secret names like: sh.helm.release.v1.zookeeper.v1
+// The last `v1` is incremented every time an upgrade occurs.
+func (e *Event) getPreviousReleaseByName() *rspb.Release {
+	previousReleaseSecretName := inferNameOfPreviousReleaseSecret(e.getReleaseObject().GetName())
 	if previousReleaseSecretName == "" {
 		return nil
 	}
@@ -69,25 +117,60 @@ func (e *Event) getPreviousRelease() *rspb.Release {
 	return e.GetRelease(previousReleaseSecretName)
 }
 
-// ListActiveReleases lists releases which have not been superseded by an upgrade, rollback or
-// other operation.
-func ListActiveReleases() []*rspb.Release {
-	kubeClient := utils.GetClient()
+// ClusterReleases are the active releases in one cluster. The cluster name is blank when
+// KubeWise watches a single cluster which has not been named.
+type ClusterReleases struct {
+	Cluster  string
+	Releases []*rspb.Release
+}
 
-	namespace := ""
-	if value, ok := os.LookupEnv("KW_NAMESPACE"); ok {
-		namespace = value
+// ListActiveReleases lists releases which have not been superseded by an upgrade, rollback or
+// other operation in a cluster. Releases in namespaces excluded by the NamespaceFilter are
+// left out.
+func ListActiveReleases(cluster *utils.Cluster) ([]*rspb.Release, error) {
+	filter := GetNamespaceFilter(cluster)
+	kubeClient := clientFor(cluster)
+
+	var results []*rspb.Release
+	for _, namespace := range filter.WatchedNamespaces() {
+		for _, driver := range GetStorageDrivers() {
+			releases, err := newHelmDriver(kubeClient, driver, namespace).List(func(r *rspb.Release) bool {
+				return r.Info.Status != rspb.StatusSuperseded
+			})
+
+			if err != nil {
+				log.Println("Error finding release", driver+"s")
+				return nil, err
+			}
+
+			results = append(results, releases...)
+		}
 	}
 
-	secrets := helmdriver.NewSecrets(kubeClient.CoreV1().Secrets(namespace))
-	results, err := secrets.List(func(r *rspb.Release) bool {
-		return r.Info.Status != rspb.StatusSuperseded
-	})
+	return filter.FilterReleases(results), nil
+}
 
-	if err != nil {
-		log.Println("Error finding release secrets")
-		return nil
+// LoadEvent builds and initializes an Event for a release revision which is stored in the
+// cluster, exactly as if its storage object had just been updated. It looks for the release in
+// every configured storage driver.
+func LoadEvent(cluster *utils.Cluster, namespace string, name string, revision int) (*Event, error) {
+	kubeClient := clientFor(cluster)
+	objectName := fmt.Sprintf("sh.helm.release.v1.%s.v%d", name, revision)
+
+	var err error
+	for _, driver := range GetStorageDrivers() {
+		releaseEvent := &Event{SecretAction: "update", Cluster: cluster}
+
+		if driver == DriverConfigMap {
+			releaseEvent.CurrentReleaseConfigMap, err = kubeClient.CoreV1().ConfigMaps(namespace).Get(objectName, meta_v1.GetOptions{})
+		} else {
+			releaseEvent.CurrentReleaseSecret, err = kubeClient.CoreV1().Secrets(namespace).Get(objectName, meta_v1.GetOptions{})
+		}
+
+		if err == nil {
+			return releaseEvent, releaseEvent.Init()
+		}
 	}
 
-	return results
+	return nil, err
 }
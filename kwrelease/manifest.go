@@ -0,0 +1,80 @@
+package kwrelease
+
+import (
+	"log"
+	"sort"
+
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"sigs.k8s.io/yaml"
+)
+
+// ManifestResource is a Kubernetes object which was rendered by a chart and applied by Helm.
+type ManifestResource struct {
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+	// Object holds the whole rendered object.
+	Object map[string]interface{}
+}
+
+// ParseManifest splits a release manifest into the objects it contains, in the order they
+// were rendered. Objects without a namespace are given the namespace of the release. Cluster
+// scoped objects are given it too, which is harmless because it is ignored when they are
+// fetched.
+func ParseManifest(manifest string, releaseNamespace string) []*ManifestResource {
+	documents := releaseutil.SplitManifests(manifest)
+	keys := make([]string, 0, len(documents))
+	for key := range documents {
+		keys = append(keys, key)
+	}
+	sort.Sort(releaseutil.BySplitManifestsOrder(keys))
+
+	resources := []*ManifestResource{}
+	for _, key := range keys {
+		object := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(documents[key]), &object); err != nil {
+			// Do NOT log the err. It may quote the manifest, which can contain secrets.
+			log.Println("Error parsing an object in the release manifest. Skipping it.")
+			continue
+		}
+
+		// Templates which render to nothing but comments leave empty documents behind.
+		if len(object) == 0 {
+			continue
+		}
+
+		resource := &ManifestResource{Object: object}
+		resource.APIVersion, _ = object["apiVersion"].(string)
+		resource.Kind, _ = object["kind"].(string)
+		if metadata, ok := object["metadata"].(map[string]interface{}); ok {
+			resource.Name, _ = metadata["name"].(string)
+			resource.Namespace, _ = metadata["namespace"].(string)
+		}
+		if resource.Namespace == "" {
+			resource.Namespace = releaseNamespace
+		}
+
+		resources = append(resources, resource)
+	}
+
+	return resources
+}
+
+// GetManifestResources returns the Kubernetes objects which were applied by the release.
+func (e *Event) GetManifestResources() []*ManifestResource {
+	return ParseManifest(e.currentRelease.Manifest, e.GetNamespace())
+}
+
+// GetWorkloads returns the Deployments, StatefulSets and DaemonSets which were applied by the
+// release. These are the objects which have a rollout which can succeed or fail.
+func (e *Event) GetWorkloads() []*ManifestResource {
+	workloads := []*ManifestResource{}
+	for _, resource := range e.GetManifestResources() {
+		switch resource.Kind {
+		case "Deployment", "StatefulSet", "DaemonSet":
+			workloads = append(workloads, resource)
+		}
+	}
+	return workloads
+}
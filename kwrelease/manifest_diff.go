@@ -0,0 +1,133 @@
+package kwrelease
+
+import (
+	"sort"
+)
+
+// ManifestChange is the way in which a Kubernetes object changed between two revisions.
+type ManifestChange string
+
+// The ways in which an object in a release can change.
+const (
+	ManifestAdded    ManifestChange = "added"
+	ManifestRemoved  ManifestChange = "removed"
+	ManifestModified ManifestChange = "modified"
+)
+
+// ResourceChange is a Kubernetes object which was added, removed or modified by a revision.
+// Fields holds the changed fields of a modified object.
+type ResourceChange struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Change    ManifestChange
+	Fields    []*ValueChange
+}
+
+// ManifestDiff holds the Kubernetes objects which changed between two revisions of a release.
+type ManifestDiff struct {
+	Resources []*ResourceChange
+}
+
+// Count returns the number of objects which changed in the given way.
+func (d *ManifestDiff) Count(change ManifestChange) int {
+	count := 0
+	for _, resource := range d.Resources {
+		if resource.Change == change {
+			count++
+		}
+	}
+	return count
+}
+
+// GetManifestDiff compares the Kubernetes objects rendered by the previous revision of the
+// release with those rendered by the current revision. It returns nil when there is no previous
+// revision to compare with.
+func (e *Event) GetManifestDiff() *ManifestDiff {
+	if e.previousRelease == nil {
+		return nil
+	}
+
+	return DiffManifests(
+		ParseManifest(e.previousRelease.Manifest, e.previousRelease.Namespace),
+		ParseManifest(e.currentRelease.Manifest, e.GetNamespace()),
+	)
+}
+
+// DiffManifests compares two sets of rendered objects. Objects are matched by kind, namespace
+// and name. The values of Secrets are replaced with *** so that they never leave the cluster.
+// Sensitive values in other objects, such as ConfigMap data and container environment
+// variables, are redacted by the Redactor in the same way as chart values.
+func DiffManifests(previous []*ManifestResource, current []*ManifestResource) *ManifestDiff {
+	diff := &ManifestDiff{Resources: []*ResourceChange{}}
+	redactor := GetRedactor()
+
+	previousByKey := make(map[string]*ManifestResource, len(previous))
+	for _, resource := range previous {
+		previousByKey[manifestKey(resource)] = resource
+	}
+
+	currentKeys := make(map[string]bool, len(current))
+	for _, resource := range current {
+		key := manifestKey(resource)
+		currentKeys[key] = true
+
+		old, ok := previousByKey[key]
+		if !ok {
+			diff.Resources = append(diff.Resources, newResourceChange(resource, ManifestAdded, nil))
+			continue
+		}
+
+		fields := DiffValues(redactor.RedactValues(old.Object), redactor.RedactValues(resource.Object))
+		if len(fields) > 0 {
+			if resource.Kind == "Secret" {
+				maskValueChanges(fields)
+			}
+			diff.Resources = append(diff.Resources, newResourceChange(resource, ManifestModified, fields))
+		}
+	}
+
+	for _, resource := range previous {
+		if !currentKeys[manifestKey(resource)] {
+			diff.Resources = append(diff.Resources, newResourceChange(resource, ManifestRemoved, nil))
+		}
+	}
+
+	sort.SliceStable(diff.Resources, func(i, j int) bool {
+		a, b := diff.Resources[i], diff.Resources[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+
+	return diff
+}
+
+func newResourceChange(resource *ManifestResource, change ManifestChange, fields []*ValueChange) *ResourceChange {
+	return &ResourceChange{
+		Kind:      resource.Kind,
+		Namespace: resource.Namespace,
+		Name:      resource.Name,
+		Change:    change,
+		Fields:    fields,
+	}
+}
+
+func manifestKey(resource *ManifestResource) string {
+	return resource.Kind + "/" + resource.Namespace + "/" + resource.Name
+}
+
+func maskValueChanges(changes []*ValueChange) {
+	for _, change := range changes {
+		if change.Old != nil {
+			change.Old = "***"
+		}
+		if change.New != nil {
+			change.New = "***"
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package kwrelease
+
+import (
+	"log"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/RoadieHQ/kubewise/utils"
+	rspb "helm.sh/helm/v3/pkg/release"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NamespaceFilter decides which namespaces KubeWise reports on. It is configured with:
+//   - KW_NAMESPACE: a comma separated list of namespaces to watch. Blank means all namespaces.
+//   - KW_NAMESPACE_EXCLUDE: a comma separated list of namespaces to ignore. Wildcards such as
+//     *-preview are supported.
+//   - KW_NAMESPACE_SELECTOR: a label selector, e.g. kubewise.io/notify=true, which a namespace
+//     must match to be reported on. Matching needs permission to get namespaces.
+type NamespaceFilter struct {
+	Include  []string
+	Exclude  []string
+	Selector labels.Selector
+	// client fetches namespaces to match against the Selector.
+	client kubernetes.Interface
+	// matches caches whether each namespace matched the Selector, so that the namespace is not
+	// fetched for every event. See namespaceMatchTTL.
+	mutex   sync.Mutex
+	matches map[string]namespaceMatch
+}
+
+// Namespace labels rarely change, but a change should be noticed without a restart.
+const namespaceMatchTTL = time.Minute
+
+type namespaceMatch struct {
+	matched   bool
+	checkedAt time.Time
+}
+
+// GetNamespaceFilter builds a NamespaceFilter from the environment. The same filter applies to
+// every cluster, but namespace labels are looked up in the given cluster.
+func GetNamespaceFilter(cluster *utils.Cluster) *NamespaceFilter {
+	filter := &NamespaceFilter{
+		Include: utils.GetEnvList("KW_NAMESPACE"),
+		Exclude: utils.GetEnvList("KW_NAMESPACE_EXCLUDE"),
+		client:  clientFor(cluster),
+		matches: make(map[string]namespaceMatch),
+	}
+
+	if value, ok := os.LookupEnv("KW_NAMESPACE_SELECTOR"); ok && value != "" {
+		selector, err := labels.Parse(value)
+		if err != nil {
+			log.Fatalln("Invalid value passed for environment variable KW_NAMESPACE_SELECTOR:", err)
+		}
+		filter.Selector = selector
+	}
+
+	return filter
+}
+
+// WatchedNamespaces returns the namespaces which must be listed and watched. A single blank
+// namespace means every namespace in the cluster. Watching a list of namespaces individually
+// allows KubeWise to run with a Role in each of them rather than a ClusterRole.
+func (f *NamespaceFilter) WatchedNamespaces() []string {
+	if len(f.Include) == 0 {
+		return []string{""}
+	}
+	return f.Include
+}
+
+// IsAllowed reports whether Helm operations in the namespace should be reported on.
+func (f *NamespaceFilter) IsAllowed(namespace string) bool {
+	if len(f.Include) > 0 && !contains(f.Include, namespace) {
+		return false
+	}
+
+	for _, pattern := range f.Exclude {
+		if matched, _ := path.Match(pattern, namespace); matched {
+			return false
+		}
+	}
+
+	if f.Selector == nil {
+		return true
+	}
+
+	return f.matchesSelector(namespace)
+}
+
+// matchesSelector reports whether the labels of a namespace match the Selector. Results are
+// cached for namespaceMatchTTL. A namespace which can not be fetched does not match.
+func (f *NamespaceFilter) matchesSelector(namespace string) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if match, ok := f.matches[namespace]; ok && time.Since(match.checkedAt) < namespaceMatchTTL {
+		return match.matched
+	}
+
+	ns, err := f.client.CoreV1().Namespaces().Get(namespace, meta_v1.GetOptions{})
+	if errors.IsForbidden(err) {
+		log.Println("KubeWise needs permission to get namespaces to match KW_NAMESPACE_SELECTOR. Skipping events in namespace", namespace+":", err)
+		return false
+	} else if err != nil && !errors.IsNotFound(err) {
+		log.Println("Error fetching namespace", namespace, "to match KW_NAMESPACE_SELECTOR:", err)
+		return false
+	}
+
+	// A namespace which has been deleted has no labels to match.
+	matched := err == nil && f.Selector.Matches(labels.Set(ns.GetLabels()))
+	f.matches[namespace] = namespaceMatch{matched: matched, checkedAt: time.Now()}
+	return matched
+}
+
+// FilterReleases removes the releases which are in namespaces that should not be reported on.
+func (f *NamespaceFilter) FilterReleases(releases []*rspb.Release) []*rspb.Release {
+	allowed := make(map[string]bool)
+	results := make([]*rspb.Release, 0, len(releases))
+
+	for _, release := range releases {
+		if _, ok := allowed[release.Namespace]; !ok {
+			allowed[release.Namespace] = f.IsAllowed(release.Namespace)
+		}
+		if allowed[release.Namespace] {
+			results = append(results, release)
+		}
+	}
+
+	return results
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package kwrelease
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// The longest value which is shown in a chat message. Longer values, such as whole lists or
+// maps which were added, are cut short.
+const maxFormattedValueLength = 120
+
+// DiffOp is the kind of change made to a field.
+type DiffOp string
+
+// The ways in which a field can change between two objects.
+const (
+	DiffOpAdd    DiffOp = "add"
+	DiffOpRemove DiffOp = "remove"
+	DiffOpChange DiffOp = "change"
+)
+
+// ValueChange is a field which differs between two objects, e.g. image.tag. Old is nil for
+// added fields and New is nil for removed fields.
+type ValueChange struct {
+	Path string
+	Op   DiffOp
+	Old  interface{}
+	New  interface{}
+}
+
+// DiffValues compares two decoded YAML or JSON values field by field. Maps are compared by key,
+// so reordered keys are not reported, and lists are compared by index. The changes are
+// returned in path order.
+func DiffValues(old interface{}, new interface{}) []*ValueChange {
+	changes := diffValues("", old, new)
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+func diffValues(path string, old interface{}, new interface{}) []*ValueChange {
+	switch {
+	case old == nil && new == nil:
+		return nil
+	case old == nil:
+		return []*ValueChange{{Path: path, Op: DiffOpAdd, New: new}}
+	case new == nil:
+		return []*ValueChange{{Path: path, Op: DiffOpRemove, Old: old}}
+	}
+
+	oldMap, oldIsMap := toStringMap(old)
+	newMap, newIsMap := toStringMap(new)
+	if oldIsMap && newIsMap {
+		changes := []*ValueChange{}
+		for key, oldValue := range oldMap {
+			changes = append(changes, diffValues(JoinPath(path, key), oldValue, newMap[key])...)
+		}
+		for key, newValue := range newMap {
+			if _, ok := oldMap[key]; !ok {
+				changes = append(changes, diffValues(JoinPath(path, key), nil, newValue)...)
+			}
+		}
+		return changes
+	}
+
+	oldList, oldIsList := old.([]interface{})
+	newList, newIsList := new.([]interface{})
+	if oldIsList && newIsList {
+		changes := []*ValueChange{}
+		for i := 0; i < len(oldList) || i < len(newList); i++ {
+			var oldValue, newValue interface{}
+			if i < len(oldList) {
+				oldValue = oldList[i]
+			}
+			if i < len(newList) {
+				newValue = newList[i]
+			}
+			changes = append(changes, diffValues(fmt.Sprintf("%s[%d]", path, i), oldValue, newValue)...)
+		}
+		return changes
+	}
+
+	if reflect.DeepEqual(old, new) || (!oldIsMap && !newIsMap && !oldIsList && !newIsList && fmt.Sprint(old) == fmt.Sprint(new)) {
+		return nil
+	}
+	return []*ValueChange{{Path: path, Op: DiffOpChange, Old: old, New: new}}
+}
+
+// toStringMap accepts the map types which Helm values and decoded manifests are made of.
+func toStringMap(value interface{}) (map[string]interface{}, bool) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		return value, true
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(value))
+		for key, v := range value {
+			converted[fmt.Sprint(key)] = v
+		}
+		return converted, true
+	}
+	return nil, false
+}
+
+// JoinPath adds a key to a dotted path. Keys which contain dots or slashes, such as most
+// annotations, are quoted so that the path can still be read.
+func JoinPath(path string, key string) string {
+	if strings.ContainsAny(key, "./ ") || key == "" {
+		return fmt.Sprintf("%s[%q]", path, key)
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// FormatValue renders a value on a single line for a chat message. Maps and lists are shown
+// as JSON and long values are cut short.
+func FormatValue(value interface{}) string {
+	var formatted string
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		formatted = value
+	case map[string]interface{}, []interface{}:
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return "?"
+		}
+		formatted = string(encoded)
+	default:
+		formatted = fmt.Sprint(value)
+	}
+
+	if len(formatted) > maxFormattedValueLength {
+		formatted = strings.ToValidUTF8(formatted[:maxFormattedValueLength], "") + "…"
+	}
+	return formatted
+}
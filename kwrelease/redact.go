@@ -0,0 +1,257 @@
+package kwrelease
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/RoadieHQ/kubewise/utils"
+)
+
+// Keys which are redacted whatever else is configured. They are matched against the dotted path
+// of each value, e.g. database.auth.password, ignoring case.
+var defaultRedactedKeys = []string{
+	"*password*",
+	"*passwd*",
+	"*secret*",
+	"*token*",
+	"*apikey*",
+	"*api_key*",
+	"*api-key*",
+	"*privatekey*",
+	"*private_key*",
+	"*credential*",
+}
+
+// Values which look like credentials wherever they appear.
+var defaultRedactedValues = []string{
+	// AWS access key IDs.
+	`\b(AKIA|ASIA)[0-9A-Z]{16}\b`,
+	// JSON Web Tokens.
+	`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`,
+	// PEM encoded private keys.
+	`-----BEGIN [A-Z ]*PRIVATE KEY-----`,
+}
+
+// Logs and event messages can contain credentials. These patterns catch the common ways they
+// are printed, e.g. password=hunter2, "token": "abc" and Authorization: Bearer abc. The first
+// group of each pattern is the part which is redacted.
+var defaultRedactedText = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)(?:password|passwd|pwd|secret|token|api[_-]?key|access[_-]?key|private[_-]?key|credentials?)["']?\s*[:=]\s*["']?([^\s"',;&]+)`),
+	regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]+=*)`),
+	regexp.MustCompile(`(?i)\bbasic\s+([A-Za-z0-9+/]+=*)`),
+	regexp.MustCompile(`://[^:/@\s]+:([^@\s]+)@`),
+	regexp.MustCompile(`(-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?(?:-----END [A-Z ]*PRIVATE KEY-----|$))`),
+}
+
+// textWord matches the words of a log line which are checked against the value patterns. Quotes
+// and the punctuation around values, e.g. in "key": "value", are not part of a word.
+var textWord = regexp.MustCompile("[^\\s\"'`,;=(){}\\[\\]<>]+")
+
+// The ways in which a redacted value can be replaced.
+const (
+	// RedactHash replaces a value with a short keyed hash of it. The same value always has the
+	// same hash, so a diff still shows that a value changed without showing the value. It needs
+	// KW_REDACT_HASH_KEY.
+	RedactHash = "hash"
+	// RedactMask replaces a value with ***.
+	RedactMask = "mask"
+)
+
+// Redactor hides sensitive chart values, and credentials in logs, before they are shown to the
+// user. It is configured
+// with environment variables:
+//   - KW_REDACT_KEYS: comma separated glob patterns which are matched against the dotted path
+//     of each value, e.g. *.secretKey. They are added to defaultRedactedKeys.
+//   - KW_REDACT_PATHS: comma separated dotted paths, e.g. postgresql.auth. Everything below
+//     them is redacted.
+//   - KW_REDACT_VALUE_PATTERNS: comma separated regular expressions which are matched against
+//     string values. They are added to defaultRedactedValues. Use \x2c for a literal comma.
+//   - KW_REDACT_MODE: hash or mask. It defaults to hash when KW_REDACT_HASH_KEY is set and
+//     to mask otherwise.
+//   - KW_REDACT_HASH_KEY: a secret key for the hash. An unkeyed hash of a short or guessable
+//     value could be reversed by hashing every possibility, so values are always masked
+//     without a key.
+//
+// Redaction can be turned off with KW_REDACT_ENABLED=false.
+type Redactor struct {
+	keys    []string
+	paths   []string
+	values  []*regexp.Regexp
+	mode    string
+	hashKey []byte
+}
+
+var (
+	redactorOnce sync.Once
+	redactor     *Redactor
+)
+
+// GetRedactor returns the Redactor configured by the environment. It is nil when redaction
+// has been turned off.
+func GetRedactor() *Redactor {
+	redactorOnce.Do(func() {
+		if utils.GetEnvBool("KW_REDACT_ENABLED", true) {
+			redactor = newRedactorFromEnv()
+		}
+	})
+	return redactor
+}
+
+func newRedactorFromEnv() *Redactor {
+	r := &Redactor{
+		mode:    RedactMask,
+		hashKey: []byte(os.Getenv("KW_REDACT_HASH_KEY")),
+	}
+
+	for _, key := range append(defaultRedactedKeys, utils.GetEnvList("KW_REDACT_KEYS")...) {
+		r.keys = append(r.keys, strings.ToLower(key))
+	}
+	for _, redactedPath := range utils.GetEnvList("KW_REDACT_PATHS") {
+		r.paths = append(r.paths, strings.ToLower(redactedPath))
+	}
+	for _, pattern := range append(defaultRedactedValues, utils.GetEnvList("KW_REDACT_VALUE_PATTERNS")...) {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			log.Println("Invalid regular expression in KW_REDACT_VALUE_PATTERNS. Skipping it:", err)
+			continue
+		}
+		r.values = append(r.values, compiled)
+	}
+
+	switch mode := strings.ToLower(os.Getenv("KW_REDACT_MODE")); mode {
+	case "":
+		if len(r.hashKey) > 0 {
+			r.mode = RedactHash
+		}
+	case RedactHash:
+		if len(r.hashKey) > 0 {
+			r.mode = RedactHash
+		} else {
+			log.Println("KW_REDACT_MODE is hash but KW_REDACT_HASH_KEY is not set. Masking redacted values instead.")
+		}
+	case RedactMask:
+	default:
+		log.Println("Invalid value passed for environment variable KW_REDACT_MODE. Options are hash or mask. Defaulting to mask.")
+	}
+
+	return r
+}
+
+// RedactValues returns a copy of chart values, or of a Kubernetes object, in which every
+// sensitive value has been replaced. The values themselves are not modified. A nil Redactor
+// returns the values as they are.
+func (r *Redactor) RedactValues(values map[string]interface{}) map[string]interface{} {
+	if r == nil || values == nil {
+		return values
+	}
+
+	redacted, _ := r.redact("", values, false).(map[string]interface{})
+	return redacted
+}
+
+func (r *Redactor) redact(valuePath string, value interface{}, sensitive bool) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		// Kubernetes lists environment variables as name and value pairs, e.g.
+		// {name: DB_PASSWORD, value: hunter2}. The value is redacted as if the name was its key.
+		namedSensitive := false
+		if name, ok := value["name"].(string); ok {
+			namedSensitive = r.isSensitivePath(JoinPath(valuePath, name))
+		}
+
+		copied := make(map[string]interface{}, len(value))
+		for key, child := range value {
+			childPath := JoinPath(valuePath, key)
+			childSensitive := sensitive || r.isSensitivePath(childPath) || (key == "value" && namedSensitive)
+			copied[key] = r.redact(childPath, child, childSensitive)
+		}
+		return copied
+
+	case []interface{}:
+		copied := make([]interface{}, len(value))
+		for i, child := range value {
+			copied[i] = r.redact(fmt.Sprintf("%s[%d]", valuePath, i), child, sensitive)
+		}
+		return copied
+
+	case nil:
+		return nil
+	}
+
+	if sensitive {
+		return r.replace(fmt.Sprint(value))
+	}
+
+	if text, ok := value.(string); ok {
+		for _, pattern := range r.values {
+			if pattern.MatchString(text) {
+				return r.replace(text)
+			}
+		}
+	}
+
+	return value
+}
+
+// RedactText returns text, such as the logs of a failed hook, in which anything that looks like
+// a credential has been replaced. Words which match the value patterns are replaced too. A nil
+// Redactor returns the text as it is.
+func (r *Redactor) RedactText(text string) string {
+	if r == nil {
+		return text
+	}
+
+	for _, pattern := range defaultRedactedText {
+		text = pattern.ReplaceAllStringFunc(text, func(match string) string {
+			secret := pattern.FindStringSubmatchIndex(match)
+			return match[:secret[2]] + r.replace(match[secret[2]:secret[3]]) + match[secret[3]:]
+		})
+	}
+
+	return textWord.ReplaceAllStringFunc(text, func(word string) string {
+		for _, pattern := range r.values {
+			if pattern.MatchString(word) {
+				return r.replace(word)
+			}
+		}
+		return word
+	})
+}
+
+// isSensitivePath reports whether the value at a path should be redacted because of its key.
+func (r *Redactor) isSensitivePath(valuePath string) bool {
+	lowerPath := strings.ToLower(valuePath)
+
+	for _, redactedPath := range r.paths {
+		if lowerPath == redactedPath {
+			return true
+		}
+	}
+
+	for _, key := range r.keys {
+		// path.Match does not treat dots as separators, so * matches any number of keys.
+		if matched, _ := path.Match(key, lowerPath); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *Redactor) replace(value string) string {
+	if r.mode == RedactMask {
+		return "***"
+	}
+
+	mac := hmac.New(sha256.New, r.hashKey)
+	mac.Write([]byte(value))
+	return "redacted:" + hex.EncodeToString(mac.Sum(nil)[:4])
+}
@@ -0,0 +1,52 @@
+package kwrelease
+
+import (
+	"time"
+)
+
+// WorkloadStatus is the rollout status of a Deployment, StatefulSet or DaemonSet.
+type WorkloadStatus struct {
+	Kind      string
+	Namespace string
+	Name      string
+	// Ready is the number of up to date pods which are available and Desired is the number
+	// there should be.
+	Ready   int32
+	Desired int32
+	Healthy bool
+	// Reason explains why an unhealthy workload is not ready, e.g. ImagePullBackOff. It may be
+	// blank when there is no obvious cause.
+	Reason string
+}
+
+// RolloutStatus is the health of the workloads in a release once it has been deployed. Helm
+// reports a successful upgrade as soon as the objects are applied unless --wait is used, so a
+// deployed release may still have pods which never come up.
+type RolloutStatus struct {
+	// Event is the event which reported that the release was deployed.
+	Event     *Event
+	Workloads []*WorkloadStatus
+	// WatchedFor is how long KubeWise watched the rollout for.
+	WatchedFor time.Duration
+}
+
+// IsHealthy reports whether every workload rolled out successfully.
+func (r *RolloutStatus) IsHealthy() bool {
+	for _, workload := range r.Workloads {
+		if !workload.Healthy {
+			return false
+		}
+	}
+	return true
+}
+
+// GetUnhealthyWorkloads returns the workloads which have not rolled out successfully.
+func (r *RolloutStatus) GetUnhealthyWorkloads() []*WorkloadStatus {
+	unhealthy := []*WorkloadStatus{}
+	for _, workload := range r.Workloads {
+		if !workload.Healthy {
+			unhealthy = append(unhealthy, workload)
+		}
+	}
+	return unhealthy
+}
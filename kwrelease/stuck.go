@@ -0,0 +1,73 @@
+package kwrelease
+
+import (
+	"time"
+
+	rspb "helm.sh/helm/v3/pkg/release"
+)
+
+// StuckRelease describes a release which has been pending for longer than expected. Helm leaves
+// a release pending forever when it is killed part way through an operation, and the next
+// operation on the release then fails with "another operation is in progress".
+type StuckRelease struct {
+	// Event is the event which marked the start of the operation which is stuck.
+	Event *Event
+	// PendingSince is when the operation started.
+	PendingSince time.Time
+	// Resolution is the event which settled the release and ResolvedAt is when it was seen.
+	// Resolution is nil while the release is stuck.
+	Resolution *Event
+	ResolvedAt time.Time
+}
+
+// GetPendingDuration returns how long the release has been, or was, pending.
+func (s *StuckRelease) GetPendingDuration() time.Duration {
+	until := time.Now()
+	if s.Resolution != nil {
+		until = s.ResolvedAt
+	}
+	return until.Sub(s.PendingSince).Round(time.Second)
+}
+
+// GetResolvedStatus returns the status of the release once it was no longer stuck, e.g.
+// "deployed". A revision which was deleted has no status of its own, so it is "deleted", or
+// "uninstalled" when the deletion completed an uninstall.
+func (s *StuckRelease) GetResolvedStatus() string {
+	if s.Resolution.SecretAction == "delete" {
+		if s.Resolution.GetAction() == ActionPostUninstall {
+			return rspb.StatusUninstalled.String()
+		}
+		return "deleted"
+	}
+	return s.Resolution.GetStatus().String()
+}
+
+// IsPending reports whether Helm is part way through an operation on the release. A deleted
+// release is never pending, even though Helm deletes the latest revision of an uninstalled
+// release while it is still marked as uninstalling.
+func (e *Event) IsPending() bool {
+	if e.SecretAction == "delete" {
+		return false
+	}
+	switch e.GetStatus() {
+	case rspb.StatusPendingInstall, rspb.StatusPendingUpgrade, rspb.StatusPendingRollback, rspb.StatusUninstalling:
+		return true
+	}
+	return false
+}
+
+// GetOperationStartedAt returns when Helm started the operation which the release is part of,
+// e.g. when the upgrade began. It falls back to the current time when Helm didn't record it.
+func (e *Event) GetOperationStartedAt() time.Time {
+	var timestamp time.Time
+	if e.GetStatus() == rspb.StatusUninstalling || e.GetStatus() == rspb.StatusUninstalled {
+		timestamp = e.currentRelease.Info.Deleted.Time
+	} else {
+		timestamp = e.currentRelease.Info.LastDeployed.Time
+	}
+
+	if timestamp.IsZero() {
+		return time.Now()
+	}
+	return timestamp
+}
@@ -0,0 +1,115 @@
+package kwrelease
+
+import (
+	"sort"
+	"time"
+
+	rspb "helm.sh/helm/v3/pkg/release"
+)
+
+// TestHookResult is the outcome of a single test hook, e.g. a Pod which checks that the
+// application responds.
+type TestHookResult struct {
+	Name        string
+	Kind        string
+	Phase       rspb.HookPhase
+	StartedAt   time.Time
+	CompletedAt time.Time
+}
+
+// GetDuration returns how long the test took to run.
+func (r *TestHookResult) GetDuration() time.Duration {
+	if r.CompletedAt.IsZero() {
+		return 0
+	}
+	return r.CompletedAt.Sub(r.StartedAt)
+}
+
+// TestRun is the result of running helm test against a release. Helm records the phase of
+// each test hook on the release when the tests finish.
+type TestRun struct {
+	Event   *Event
+	Results []*TestHookResult
+}
+
+// IsSuccessful reports whether every test hook succeeded.
+func (t *TestRun) IsSuccessful() bool {
+	for _, result := range t.Results {
+		if result.Phase != rspb.HookPhaseSucceeded {
+			return false
+		}
+	}
+	return true
+}
+
+// GetCompletedAt returns when the last test hook completed.
+func (t *TestRun) GetCompletedAt() time.Time {
+	var completedAt time.Time
+	for _, result := range t.Results {
+		if result.CompletedAt.After(completedAt) {
+			completedAt = result.CompletedAt
+		}
+	}
+	return completedAt
+}
+
+// GetTestRun returns the results of the last helm test of the current revision of the release.
+// It returns nil if the tests have not been run since the release was deployed. A rollback
+// copies the hooks of an older revision, along with its test results, so results from before
+// the release was deployed are ignored.
+//
+// Helm saves the release as each test hook starts, with the hook in the Running phase. The
+// results are only returned once every test hook has finished.
+func (e *Event) GetTestRun() *TestRun {
+	results := []*TestHookResult{}
+	deployedAt := e.currentRelease.Info.LastDeployed.Time
+
+	for _, hook := range e.currentRelease.Hooks {
+		if hook == nil || !isTestHook(hook) || hook.LastRun.StartedAt.IsZero() {
+			continue
+		}
+		if hook.LastRun.StartedAt.Time.Before(deployedAt) {
+			continue
+		}
+		if !isFinished(hook) {
+			return nil
+		}
+
+		results = append(results, &TestHookResult{
+			Name:        hook.Name,
+			Kind:        hook.Kind,
+			Phase:       hook.LastRun.Phase,
+			StartedAt:   hook.LastRun.StartedAt.Time,
+			CompletedAt: hook.LastRun.CompletedAt.Time,
+		})
+	}
+
+	if len(results) == 0 {
+		return nil
+	}
+
+	// Hooks are stored in the order they are defined in the chart. Report them in the order
+	// they ran.
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].StartedAt.Before(results[j].StartedAt)
+	})
+
+	return &TestRun{Event: e, Results: results}
+}
+
+func isFinished(hook *rspb.Hook) bool {
+	if hook.LastRun.CompletedAt.IsZero() {
+		return false
+	}
+	return hook.LastRun.Phase == rspb.HookPhaseSucceeded || hook.LastRun.Phase == rspb.HookPhaseFailed
+}
+
+func isTestHook(hook *rspb.Hook) bool {
+	for _, event := range hook.Events {
+		// Helm 2 charts used test-success for the same purpose.
+		if event == rspb.HookTest || event == "test-success" {
+			return true
+		}
+	}
+	return false
+}
@@ -8,28 +8,36 @@ import (
 	"github.com/RoadieHQ/kubewise/handlers"
 	"github.com/RoadieHQ/kubewise/handlers/googlechat"
 	"github.com/RoadieHQ/kubewise/handlers/slack"
+	"github.com/RoadieHQ/kubewise/handlers/stdout"
 	"github.com/RoadieHQ/kubewise/handlers/webhook"
-	"github.com/RoadieHQ/kubewise/kwrelease"
+	"github.com/RoadieHQ/kubewise/replay"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		os.Exit(replay.Main(os.Args[2:], newEventHandler))
+	}
+
 	if _, ok := os.LookupEnv("KW_HANDLER"); !ok {
 		log.Fatalln("KW_HANDLER environment variable is required.")
 	}
 
-	var eventHandler handlers.Handler
-	switch os.Getenv("KW_HANDLER") {
+	eventHandler := newEventHandler(os.Getenv("KW_HANDLER"))
+	eventHandler.Init()
+	// This is a blocking call. Code placed after this won't run until teardown.
+	controller.Start(eventHandler)
+}
+
+func newEventHandler(name string) handlers.Handler {
+	switch name {
 	case "googlechat":
-		eventHandler = new(googlechat.GoogleChat)
+		return new(googlechat.GoogleChat)
 	case "webhook":
-		eventHandler = new(webhook.Webhook)
+		return new(webhook.Webhook)
+	case "stdout":
+		return new(stdout.Stdout)
 	// Slack is the default for backwards compatibility reasons. It was the first handler.
 	default:
-		eventHandler = new(slack.Slack)
+		return new(slack.Slack)
 	}
-
-	eventHandler.Init()
-	eventHandler.HandleServerStartup(kwrelease.ListActiveReleases())
-	// This is a blocking call. Code placed after this won't run until teardown.
-	controller.Start(eventHandler)
 }
@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var releaseDriftedFields = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "helm_release_drifted_fields",
+		Help:      "Number of fields in each deployed Helm release which were changed outside Helm at the last drift check.",
+	},
+	[]string{"cluster", "release", "namespace"},
+)
+
+func init() {
+	prometheus.MustRegister(releaseDriftedFields)
+}
+
+// SetDriftedFields records the number of fields which have drifted in a release.
+func SetDriftedFields(cluster string, namespace string, name string, count int) {
+	releaseDriftedFields.WithLabelValues(cluster, name, namespace).Set(float64(count))
+}
+
+// DeleteDriftedFields removes the drift count of a release which is no longer deployed.
+func DeleteDriftedFields(cluster string, namespace string, name string) {
+	releaseDriftedFields.DeleteLabelValues(cluster, name, namespace)
+}
@@ -0,0 +1,125 @@
+// Package metrics holds the Prometheus metrics which KubeWise exposes on /metrics. They make it
+// possible to alert when notifications silently stop being delivered.
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "kubewise"
+
+var (
+	// EventsProcessed counts the Helm events which were handled, by action.
+	EventsProcessed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "helm_events_processed_total",
+			Help:      "Number of Helm release events processed, by action.",
+		},
+		[]string{"action"},
+	)
+
+	// NotificationsSuppressed counts the notifications which were not sent because the user had
+	// already been notified about the same release revision and status.
+	NotificationsSuppressed = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "notifications_suppressed_total",
+			Help:      "Number of duplicate notifications which were not sent.",
+		},
+	)
+
+	notifications = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "notifications_total",
+			Help:      "Number of notifications sent by each handler, by result (sent or failed).",
+		},
+		[]string{"handler", "result"},
+	)
+
+	handlerDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "handler_duration_seconds",
+			Help:      "Time taken by each handler to deliver a notification.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"handler"},
+	)
+
+	operationDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "helm_operation_duration_seconds",
+			Help:      "Time taken by Helm to install, upgrade, roll back or uninstall a release, by chart and action.",
+			// From 1 second up to about 34 minutes.
+			Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+		},
+		[]string{"chart", "action"},
+	)
+
+	// QueueRetries counts the retries of events which failed to process. A failed event is
+	// retried in place, with backoff, by the worker which holds it.
+	QueueRetries = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "workqueue_retries_total",
+			Help:      "Number of times an event which failed to process was retried by its worker.",
+		},
+	)
+
+	// QueueGiveUps counts the events which were dropped after failing too many times.
+	QueueGiveUps = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "workqueue_giveups_total",
+			Help:      "Number of events which were dropped after too many retries.",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(
+		EventsProcessed,
+		NotificationsSuppressed,
+		notifications,
+		handlerDuration,
+		operationDuration,
+		QueueRetries,
+		QueueGiveUps,
+	)
+}
+
+// ObserveNotification records the result and latency of a handler delivering a notification.
+// The start time should be taken immediately before the request is made.
+func ObserveNotification(handler string, start time.Time, err error) {
+	handlerDuration.WithLabelValues(handler).Observe(time.Since(start).Seconds())
+
+	result := "sent"
+	if err != nil {
+		result = "failed"
+	}
+	notifications.WithLabelValues(handler, result).Inc()
+}
+
+// ObserveOperationDuration records how long Helm took to perform an action on a release of
+// a chart.
+func ObserveOperationDuration(chart string, action string, duration time.Duration) {
+	operationDuration.WithLabelValues(chart, action).Observe(duration.Seconds())
+}
+
+// RegisterQueueDepth exposes the number of events waiting to be processed. The function is
+// called each time the metrics are scraped.
+func RegisterQueueDepth(depth func() float64) {
+	prometheus.MustRegister(prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "workqueue_depth",
+			Help:      "Number of events waiting to be processed.",
+		},
+		depth,
+	))
+}
@@ -0,0 +1,142 @@
+package metrics
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	rspb "helm.sh/helm/v3/pkg/release"
+)
+
+var (
+	releaseInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "helm_release_info",
+			Help:      "Information about each installed Helm release. The value is always 1.",
+		},
+		[]string{"cluster", "release", "namespace", "chart", "chart_version", "app_version", "status", "revision"},
+	)
+
+	releaseLastDeployed = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "helm_release_last_deployed_timestamp_seconds",
+			Help:      "Unix time at which each installed Helm release was last deployed.",
+		},
+		[]string{"cluster", "release", "namespace"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(releaseInfo, releaseLastDeployed)
+}
+
+// inventory remembers the labels of the info series for each release so that the old series
+// can be removed when the release changes. Otherwise an upgraded release would be reported at
+// both its old and new versions.
+var inventory = struct {
+	sync.Mutex
+	releases map[inventoryKey]*inventoryRelease
+}{releases: make(map[inventoryKey]*inventoryRelease)}
+
+// inventoryRelease is what the inventory keeps of a release. The decoded release holds the chart
+// templates, manifest and values, which would use a lot of memory to keep for every release.
+type inventoryRelease struct {
+	revision int
+	labels   prometheus.Labels
+}
+
+type inventoryKey struct {
+	cluster   string
+	namespace string
+	name      string
+}
+
+// SetReleases replaces the release inventory for a cluster with the latest revision of each of
+// the given releases. It is given the releases in the cluster when KubeWise starts up. The
+// cluster name is blank when KubeWise watches a single cluster which has not been named.
+func SetReleases(cluster string, releases []*rspb.Release) {
+	inventory.Lock()
+	defer inventory.Unlock()
+
+	for key := range inventory.releases {
+		if key.cluster == cluster {
+			deleteRelease(key)
+		}
+	}
+
+	for _, release := range releases {
+		setRelease(cluster, release)
+	}
+}
+
+// SetRelease updates the inventory with a release which has been installed, upgraded, rolled
+// back or has changed status. An older revision of a release than the one already in the
+// inventory is ignored.
+func SetRelease(cluster string, release *rspb.Release) {
+	inventory.Lock()
+	defer inventory.Unlock()
+
+	setRelease(cluster, release)
+}
+
+// DeleteRelease removes an uninstalled release from the inventory.
+func DeleteRelease(cluster string, namespace string, name string) {
+	inventory.Lock()
+	defer inventory.Unlock()
+
+	deleteRelease(inventoryKey{cluster: cluster, namespace: namespace, name: name})
+}
+
+func setRelease(cluster string, release *rspb.Release) {
+	if release == nil || release.Info == nil || release.Chart == nil || release.Chart.Metadata == nil {
+		return
+	}
+
+	key := inventoryKey{cluster: cluster, namespace: release.Namespace, name: release.Name}
+
+	// Helm keeps uninstalled releases around when --keep-history is used.
+	if release.Info.Status == rspb.StatusUninstalled {
+		deleteRelease(key)
+		return
+	}
+
+	if existing, ok := inventory.releases[key]; ok {
+		if existing.revision > release.Version {
+			return
+		}
+		releaseInfo.Delete(existing.labels)
+	}
+
+	labels := infoLabels(cluster, release)
+	inventory.releases[key] = &inventoryRelease{revision: release.Version, labels: labels}
+	releaseInfo.With(labels).Set(1)
+	if !release.Info.LastDeployed.IsZero() {
+		releaseLastDeployed.WithLabelValues(cluster, release.Name, release.Namespace).Set(float64(release.Info.LastDeployed.Unix()))
+	}
+}
+
+func deleteRelease(key inventoryKey) {
+	existing, ok := inventory.releases[key]
+	if !ok {
+		return
+	}
+
+	releaseInfo.Delete(existing.labels)
+	releaseLastDeployed.DeleteLabelValues(key.cluster, key.name, key.namespace)
+	delete(inventory.releases, key)
+}
+
+func infoLabels(cluster string, release *rspb.Release) prometheus.Labels {
+	return prometheus.Labels{
+		"cluster":       cluster,
+		"release":       release.Name,
+		"namespace":     release.Namespace,
+		"chart":         release.Chart.Metadata.Name,
+		"chart_version": release.Chart.Metadata.Version,
+		"app_version":   release.Chart.Metadata.AppVersion,
+		"status":        release.Info.Status.String(),
+		"revision":      strconv.Itoa(release.Version),
+	}
+}
@@ -2,6 +2,7 @@ package presenters
 
 import (
 	"os"
+	"time"
 
 	"github.com/RoadieHQ/kubewise/kwrelease"
 	rspb "helm.sh/helm/v3/pkg/release"
@@ -20,6 +21,7 @@ type ReleaseEventForJSON struct {
 	AppName              string       `json:"appName"`
 	AppVersion           string       `json:"appVersion"`
 	Namespace            string       `json:"namespace"`
+	Cluster              string       `json:"cluster,omitempty"`
 	PreviousAppVersion   string       `json:"previousAppVersion,omitempty"`
 	Action               string       `json:"action"`
 	AppDescription       string       `json:"appDescription"`
@@ -31,6 +33,153 @@ type ReleaseEventForJSON struct {
 	ChartVersion         string       `json:"chartVersion"`
 	PreviousChartVersion string       `json:"previousChartVersion"`
 	ReleaseDescription   string       `json:"releaseDescription"`
+	Revision             int          `json:"revision"`
+	// PreviousRevision is the revision which the current revision was compared with. For an
+	// upgrade, it is the last revision which was successfully deployed. For a rollback, it is
+	// the revision which was restored.
+	PreviousRevision int `json:"previousRevision,omitempty"`
+	// RollbackRevision is the revision which a rollback restored. ReplacedRevision and
+	// ReplacedChartVersion belong to the revision which it rolled back from.
+	RollbackRevision     int    `json:"rollbackRevision,omitempty"`
+	ReplacedRevision     int    `json:"replacedRevision,omitempty"`
+	ReplacedChartVersion string `json:"replacedChartVersion,omitempty"`
+	// DurationSeconds is how long the operation took. It is only set when KubeWise saw the
+	// operation start.
+	DurationSeconds float64 `json:"durationSeconds,omitempty"`
+	// FailureDetails is only set for failed releases when KW_FAILURE_DETAILS_ENABLED is set.
+	FailureDetails *FailureDetailsForJSON `json:"failureDetails,omitempty"`
+	// ManifestDiff is only set for operations on an existing release when
+	// KW_MANIFEST_DIFF_ENABLED is set.
+	ManifestDiff *ManifestDiffForJSON `json:"manifestDiff,omitempty"`
+	// ConfigDiff lists the chart values which changed, by path. It is only set for operations on
+	// an existing release when KW_CHART_VALUES_DIFF_ENABLED is set.
+	ConfigDiff []*ValueChangeForJSON `json:"configDiff,omitempty"`
+}
+
+// ManifestDiffForJSON holds the Kubernetes objects which changed between the previous and the
+// current revision of a release.
+type ManifestDiffForJSON struct {
+	Added     int                      `json:"added"`
+	Modified  int                      `json:"modified"`
+	Removed   int                      `json:"removed"`
+	Resources []*ResourceChangeForJSON `json:"resources"`
+}
+
+// ResourceChangeForJSON is a single object in a ManifestDiffForJSON. The change is added,
+// removed or modified. Only modified objects have fields.
+type ResourceChangeForJSON struct {
+	Kind      string                `json:"kind"`
+	Namespace string                `json:"namespace"`
+	Name      string                `json:"name"`
+	Change    string                `json:"change"`
+	Fields    []*ValueChangeForJSON `json:"fields"`
+}
+
+// ValueChangeForJSON is a single changed field. The op is add, remove or change. Old is left
+// out of added fields and new is left out of removed fields.
+type ValueChangeForJSON struct {
+	Path string      `json:"path"`
+	Op   string      `json:"op"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+func toValueChangesForJSON(changes []*kwrelease.ValueChange) []*ValueChangeForJSON {
+	container := make([]*ValueChangeForJSON, 0, len(changes))
+	for _, change := range changes {
+		container = append(container, &ValueChangeForJSON{
+			Path: change.Path,
+			Op:   string(change.Op),
+			Old:  change.Old,
+			New:  change.New,
+		})
+	}
+	return container
+}
+
+// diffActions are the actions which change an existing release. The webhook payload for them
+// can include what changed. A rollback is compared with the revision it restores, which has the
+// same chart values and manifest, so there is nothing to include.
+var diffActions = map[kwrelease.Action]bool{
+	kwrelease.ActionPreUpgrade:    true,
+	kwrelease.ActionPostUpgrade:   true,
+	kwrelease.ActionPostReplace:   true,
+	kwrelease.ActionFailedReplace: true,
+}
+
+func toManifestDiffForJSON(diff *kwrelease.ManifestDiff) *ManifestDiffForJSON {
+	container := ManifestDiffForJSON{
+		Added:     diff.Count(kwrelease.ManifestAdded),
+		Modified:  diff.Count(kwrelease.ManifestModified),
+		Removed:   diff.Count(kwrelease.ManifestRemoved),
+		Resources: make([]*ResourceChangeForJSON, 0, len(diff.Resources)),
+	}
+
+	for _, resource := range diff.Resources {
+		container.Resources = append(container.Resources, &ResourceChangeForJSON{
+			Kind:      resource.Kind,
+			Namespace: resource.Namespace,
+			Name:      resource.Name,
+			Change:    string(resource.Change),
+			Fields:    toValueChangesForJSON(resource.Fields),
+		})
+	}
+
+	return &container
+}
+
+// FailureDetailsForJSON holds the logs of failed hooks and the warnings which Kubernetes
+// recorded while a failed operation was running.
+type FailureDetailsForJSON struct {
+	HookLogs []*PodLogsForJSON         `json:"hookLogs"`
+	Events   []*KubernetesEventForJSON `json:"events"`
+}
+
+// PodLogsForJSON is the end of the logs of a single container in a hook pod.
+type PodLogsForJSON struct {
+	Hook      string `json:"hook"`
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	Logs      string `json:"logs"`
+}
+
+// KubernetesEventForJSON is a single warning event.
+type KubernetesEventForJSON struct {
+	Kind     string    `json:"kind"`
+	Name     string    `json:"name"`
+	Reason   string    `json:"reason"`
+	Message  string    `json:"message"`
+	Count    int32     `json:"count"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+func toFailureDetailsForJSON(details *kwrelease.FailureDetails) *FailureDetailsForJSON {
+	container := FailureDetailsForJSON{
+		HookLogs: make([]*PodLogsForJSON, 0, len(details.HookLogs)),
+		Events:   make([]*KubernetesEventForJSON, 0, len(details.Events)),
+	}
+
+	for _, podLogs := range details.HookLogs {
+		container.HookLogs = append(container.HookLogs, &PodLogsForJSON{
+			Hook:      podLogs.Hook,
+			Pod:       podLogs.Pod,
+			Container: podLogs.Container,
+			Logs:      podLogs.Logs,
+		})
+	}
+
+	for _, event := range details.Events {
+		container.Events = append(container.Events, &KubernetesEventForJSON{
+			Kind:     event.Kind,
+			Name:     event.Name,
+			Reason:   event.Reason,
+			Message:  event.Message,
+			Count:    event.Count,
+			LastSeen: event.LastSeen,
+		})
+	}
+
+	return &container
 }
 
 // ToReleaseEventForJSON takes a release Event and turns it into a ReleaseEventForJSON. It holds
@@ -40,6 +189,7 @@ func ToReleaseEventForJSON(e *kwrelease.Event) *ReleaseEventForJSON {
 		AppName:              e.GetAppName(),
 		AppVersion:           e.GetAppVersion(),
 		Namespace:            e.GetNamespace(),
+		Cluster:              e.GetClusterName(),
 		Action:               e.GetAction().String(),
 		InstallNotes:         e.GetNotes(),
 		AppDescription:       e.GetAppDescription(),
@@ -49,6 +199,31 @@ func ToReleaseEventForJSON(e *kwrelease.Event) *ReleaseEventForJSON {
 		PreviousChartVersion: e.GetPreviousChartVersion(),
 		ReleaseDescription:   e.GetReleaseDescription(),
 		PreviousAppVersion:   e.GetPreviousAppVersion(),
+		DurationSeconds:      e.GetDuration().Seconds(),
+		Revision:             e.GetRevision(),
+		PreviousRevision:     e.GetPreviousRevision(),
+		RollbackRevision:     e.GetRollbackRevision(),
+	}
+
+	if event.RollbackRevision > 0 {
+		event.ReplacedRevision = e.GetReplacedRevision()
+		event.ReplacedChartVersion = e.GetReplacedChartVersion()
+	}
+
+	if isManifestDiffEnabled() && diffActions[e.GetAction()] {
+		if diff := e.GetManifestDiff(); diff != nil {
+			event.ManifestDiff = toManifestDiffForJSON(diff)
+		}
+	}
+
+	if isConfigDiffEnabled() && diffActions[e.GetAction()] {
+		if changes := e.GetConfigDiff(); len(changes) > 0 {
+			event.ConfigDiff = toValueChangesForJSON(changes)
+		}
+	}
+
+	if details := e.GetFailureDetails(); details != nil {
+		event.FailureDetails = toFailureDetailsForJSON(details)
 	}
 
 	if value := e.GetLabelsModifiedAtTimestamp(); !value.IsZero() {
@@ -65,8 +240,8 @@ func ToReleaseEventForJSON(e *kwrelease.Event) *ReleaseEventForJSON {
 // ExistingReleasesForJSON is used to marshal Helm release objects so they can be sent to an API.
 //
 // There are two problems which just directly marshaling Helm release objects.
-//   1. They may contain sensitive data which should not leave the cluster.
-//   2. They are huge when marshalled because all the templates are stored within.
+//  1. They may contain sensitive data which should not leave the cluster.
+//  2. They are huge when marshalled because all the templates are stored within.
 //
 // By implementing a custom struct we effectively whitelist the properties which should be
 // send to any API.
@@ -78,9 +253,10 @@ type ExistingReleasesForJSON struct {
 	ExistingReleases []*ExistingReleaseForJSON `json:"existingReleases"`
 }
 
-// ToExistingReleasesForJSON takes a release Event and turns it into a ToExistingReleasesForJSON.
-// It holds knowledge such where to find the message prefix environment variable.
-func ToExistingReleasesForJSON(releases []*rspb.Release) *ExistingReleasesForJSON {
+// ToExistingReleasesForJSON takes the releases in each cluster and turns them into a
+// ExistingReleasesForJSON. It holds knowledge such where to find the message prefix environment
+// variable. The releases from every cluster are sent in one list, each tagged with its cluster.
+func ToExistingReleasesForJSON(clusters []*kwrelease.ClusterReleases) *ExistingReleasesForJSON {
 	container := ExistingReleasesForJSON{}
 
 	if value, ok := os.LookupEnv("KW_MESSAGE_PREFIX"); ok {
@@ -90,8 +266,10 @@ func ToExistingReleasesForJSON(releases []*rspb.Release) *ExistingReleasesForJSO
 	// Using make here ensures that the empty state is an empty slice rather than null. It's the
 	// difference between receiving {"existingReleases":[]} at the API vs. {"existingReleases":null}
 	existingReleases := make([]*ExistingReleaseForJSON, 0)
-	for _, release := range releases {
-		existingReleases = append(existingReleases, toExistingReleaseForJSON(release))
+	for _, cluster := range clusters {
+		for _, release := range cluster.Releases {
+			existingReleases = append(existingReleases, toExistingReleaseForJSON(cluster.Cluster, release))
+		}
 	}
 	container.ExistingReleases = existingReleases
 
@@ -104,20 +282,361 @@ type ExistingReleaseForJSON struct {
 	AppName            string `json:"appName"`
 	AppVersion         string `json:"appVersion"`
 	Namespace          string `json:"namespace"`
+	Cluster            string `json:"cluster,omitempty"`
 	AppDescription     string `json:"appDescription"`
 	InstallNotes       string `json:"installNotes"`
 	ChartVersion       string `json:"chartVersion"`
 	ReleaseDescription string `json:"releaseDescription"`
 }
 
-func toExistingReleaseForJSON(r *rspb.Release) *ExistingReleaseForJSON {
+func toExistingReleaseForJSON(cluster string, r *rspb.Release) *ExistingReleaseForJSON {
 	return &ExistingReleaseForJSON{
 		AppName:            r.Name,
 		AppVersion:         r.Chart.AppVersion(),
 		Namespace:          r.Namespace,
+		Cluster:            cluster,
 		InstallNotes:       r.Info.Notes,
 		AppDescription:     r.Chart.Metadata.Description,
 		ChartVersion:       r.Chart.Metadata.Version,
 		ReleaseDescription: r.Info.Description,
 	}
 }
+
+// ServerShutdownForJSON is sent when KubeWise shuts down. The action allows an API to tell it
+// apart from release events.
+type ServerShutdownForJSON struct {
+	MessagePrefix string `json:"messagePrefix,omitempty"`
+	Action        string `json:"action"`
+}
+
+// ToServerShutdownForJSON creates a ServerShutdownForJSON. It holds knowledge such as where to
+// find the message prefix environment variable.
+func ToServerShutdownForJSON() *ServerShutdownForJSON {
+	container := ServerShutdownForJSON{
+		Action: "SERVER_SHUTDOWN",
+	}
+
+	if value, ok := os.LookupEnv("KW_MESSAGE_PREFIX"); ok {
+		container.MessagePrefix = value
+	}
+
+	return &container
+}
+
+// StuckReleaseForJSON is sent when a release has been pending for too long and again when it
+// settles. The action is RELEASE_STUCK or RELEASE_STUCK_RESOLVED.
+type StuckReleaseForJSON struct {
+	MessagePrefix  string    `json:"messagePrefix,omitempty"`
+	Action         string    `json:"action"`
+	AppName        string    `json:"appName"`
+	Namespace      string    `json:"namespace"`
+	Cluster        string    `json:"cluster,omitempty"`
+	Revision       int       `json:"revision"`
+	Status         string    `json:"status"`
+	PendingSince   time.Time `json:"pendingSince"`
+	PendingSeconds float64   `json:"pendingSeconds"`
+	ResolvedStatus string    `json:"resolvedStatus,omitempty"`
+}
+
+// ToStuckReleaseForJSON creates a StuckReleaseForJSON. It holds knowledge such as where to find
+// the message prefix environment variable.
+func ToStuckReleaseForJSON(stuck *kwrelease.StuckRelease) *StuckReleaseForJSON {
+	container := StuckReleaseForJSON{
+		Action:         "RELEASE_STUCK",
+		AppName:        stuck.Event.GetAppName(),
+		Namespace:      stuck.Event.GetNamespace(),
+		Cluster:        stuck.Event.GetClusterName(),
+		Revision:       stuck.Event.GetRevision(),
+		Status:         stuck.Event.GetStatus().String(),
+		PendingSince:   stuck.PendingSince,
+		PendingSeconds: stuck.GetPendingDuration().Seconds(),
+	}
+
+	if stuck.Resolution != nil {
+		container.Action = "RELEASE_STUCK_RESOLVED"
+		container.ResolvedStatus = stuck.GetResolvedStatus()
+	}
+
+	if value, ok := os.LookupEnv("KW_MESSAGE_PREFIX"); ok {
+		container.MessagePrefix = value
+	}
+
+	return &container
+}
+
+// RolloutStatusForJSON is sent once KubeWise has watched the workloads in a release roll out.
+// The action is ROLLOUT_HEALTHY or ROLLOUT_UNHEALTHY.
+type RolloutStatusForJSON struct {
+	MessagePrefix  string             `json:"messagePrefix,omitempty"`
+	Action         string             `json:"action"`
+	AppName        string             `json:"appName"`
+	Namespace      string             `json:"namespace"`
+	Cluster        string             `json:"cluster,omitempty"`
+	ChartVersion   string             `json:"chartVersion"`
+	Revision       int                `json:"revision"`
+	WatchedSeconds float64            `json:"watchedSeconds"`
+	Workloads      []*WorkloadForJSON `json:"workloads"`
+}
+
+// WorkloadForJSON is the rollout status of a single Deployment, StatefulSet or DaemonSet.
+type WorkloadForJSON struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Ready     int32  `json:"ready"`
+	Desired   int32  `json:"desired"`
+	Healthy   bool   `json:"healthy"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// ToRolloutStatusForJSON creates a RolloutStatusForJSON. It holds knowledge such as where to
+// find the message prefix environment variable.
+func ToRolloutStatusForJSON(rollout *kwrelease.RolloutStatus) *RolloutStatusForJSON {
+	container := RolloutStatusForJSON{
+		Action:         "ROLLOUT_HEALTHY",
+		AppName:        rollout.Event.GetAppName(),
+		Namespace:      rollout.Event.GetNamespace(),
+		Cluster:        rollout.Event.GetClusterName(),
+		ChartVersion:   rollout.Event.GetChartVersion(),
+		Revision:       rollout.Event.GetRevision(),
+		WatchedSeconds: rollout.WatchedFor.Seconds(),
+		Workloads:      make([]*WorkloadForJSON, 0, len(rollout.Workloads)),
+	}
+
+	if !rollout.IsHealthy() {
+		container.Action = "ROLLOUT_UNHEALTHY"
+	}
+
+	for _, workload := range rollout.Workloads {
+		container.Workloads = append(container.Workloads, &WorkloadForJSON{
+			Kind:      workload.Kind,
+			Namespace: workload.Namespace,
+			Name:      workload.Name,
+			Ready:     workload.Ready,
+			Desired:   workload.Desired,
+			Healthy:   workload.Healthy,
+			Reason:    workload.Reason,
+		})
+	}
+
+	if value, ok := os.LookupEnv("KW_MESSAGE_PREFIX"); ok {
+		container.MessagePrefix = value
+	}
+
+	return &container
+}
+
+// TestRunForJSON is sent when helm test has been run against a release. The action is
+// TEST_SUCCEEDED or TEST_FAILED.
+type TestRunForJSON struct {
+	MessagePrefix string               `json:"messagePrefix,omitempty"`
+	Action        string               `json:"action"`
+	AppName       string               `json:"appName"`
+	Namespace     string               `json:"namespace"`
+	Cluster       string               `json:"cluster,omitempty"`
+	ChartVersion  string               `json:"chartVersion"`
+	Revision      int                  `json:"revision"`
+	Tests         []*TestResultForJSON `json:"tests"`
+}
+
+// TestResultForJSON is the result of a single test hook in a TestRunForJSON.
+type TestResultForJSON struct {
+	Name            string    `json:"name"`
+	Kind            string    `json:"kind"`
+	Phase           string    `json:"phase"`
+	StartedAt       time.Time `json:"startedAt"`
+	CompletedAt     time.Time `json:"completedAt"`
+	DurationSeconds float64   `json:"durationSeconds"`
+}
+
+// ToTestRunForJSON creates a TestRunForJSON. It holds knowledge such as where to find the
+// message prefix environment variable.
+func ToTestRunForJSON(testRun *kwrelease.TestRun) *TestRunForJSON {
+	container := TestRunForJSON{
+		Action:       "TEST_SUCCEEDED",
+		AppName:      testRun.Event.GetAppName(),
+		Namespace:    testRun.Event.GetNamespace(),
+		Cluster:      testRun.Event.GetClusterName(),
+		ChartVersion: testRun.Event.GetChartVersion(),
+		Revision:     testRun.Event.GetRevision(),
+		Tests:        make([]*TestResultForJSON, 0, len(testRun.Results)),
+	}
+
+	if !testRun.IsSuccessful() {
+		container.Action = "TEST_FAILED"
+	}
+
+	for _, result := range testRun.Results {
+		container.Tests = append(container.Tests, &TestResultForJSON{
+			Name:            result.Name,
+			Kind:            result.Kind,
+			Phase:           result.Phase.String(),
+			StartedAt:       result.StartedAt,
+			CompletedAt:     result.CompletedAt,
+			DurationSeconds: result.GetDuration().Seconds(),
+		})
+	}
+
+	if value, ok := os.LookupEnv("KW_MESSAGE_PREFIX"); ok {
+		container.MessagePrefix = value
+	}
+
+	return &container
+}
+
+// ReleaseDriftForJSON is sent when objects in a release have been changed outside Helm. The
+// action is RELEASE_DRIFTED.
+type ReleaseDriftForJSON struct {
+	MessagePrefix string                  `json:"messagePrefix,omitempty"`
+	Action        string                  `json:"action"`
+	AppName       string                  `json:"appName"`
+	Namespace     string                  `json:"namespace"`
+	Cluster       string                  `json:"cluster,omitempty"`
+	ChartVersion  string                  `json:"chartVersion"`
+	Revision      int                     `json:"revision"`
+	CheckedAt     time.Time               `json:"checkedAt"`
+	DriftedFields int                     `json:"driftedFields"`
+	Resources     []*ResourceDriftForJSON `json:"resources"`
+}
+
+// ResourceDriftForJSON is a single object in a ReleaseDriftForJSON. The values of Secrets are
+// replaced with ***.
+type ResourceDriftForJSON struct {
+	Kind      string               `json:"kind"`
+	Namespace string               `json:"namespace"`
+	Name      string               `json:"name"`
+	Missing   bool                 `json:"missing"`
+	Fields    []*FieldDriftForJSON `json:"fields"`
+}
+
+// FieldDriftForJSON is a single field whose live value differs from the release manifest.
+type FieldDriftForJSON struct {
+	Path     string `json:"path"`
+	Expected string `json:"expected"`
+	Live     string `json:"live"`
+}
+
+// ToReleaseDriftForJSON creates a ReleaseDriftForJSON. It holds knowledge such as where to
+// find the message prefix environment variable.
+func ToReleaseDriftForJSON(drift *kwrelease.ReleaseDrift) *ReleaseDriftForJSON {
+	container := ReleaseDriftForJSON{
+		Action:        "RELEASE_DRIFTED",
+		AppName:       drift.Event.GetAppName(),
+		Namespace:     drift.Event.GetNamespace(),
+		Cluster:       drift.Event.GetClusterName(),
+		ChartVersion:  drift.Event.GetChartVersion(),
+		Revision:      drift.Event.GetRevision(),
+		CheckedAt:     drift.CheckedAt,
+		DriftedFields: drift.GetFieldCount(),
+		Resources:     make([]*ResourceDriftForJSON, 0, len(drift.Resources)),
+	}
+
+	for _, resource := range drift.Resources {
+		resourceDrift := &ResourceDriftForJSON{
+			Kind:      resource.Kind,
+			Namespace: resource.Namespace,
+			Name:      resource.Name,
+			Missing:   resource.Missing,
+			Fields:    make([]*FieldDriftForJSON, 0, len(resource.Fields)),
+		}
+		for _, field := range resource.Fields {
+			resourceDrift.Fields = append(resourceDrift.Fields, &FieldDriftForJSON{
+				Path:     field.Path,
+				Expected: field.Expected,
+				Live:     field.Live,
+			})
+		}
+		container.Resources = append(container.Resources, resourceDrift)
+	}
+
+	if value, ok := os.LookupEnv("KW_MESSAGE_PREFIX"); ok {
+		container.MessagePrefix = value
+	}
+
+	return &container
+}
+
+// DigestForJSON is the scheduled digest. The action is DIGEST.
+type DigestForJSON struct {
+	MessagePrefix string    `json:"messagePrefix,omitempty"`
+	Action        string    `json:"action"`
+	Since         time.Time `json:"since"`
+	Until         time.Time `json:"until"`
+	// Changes are the operations since the last digest, oldest first.
+	Changes        []*ReleaseChangeForJSON `json:"changes"`
+	DroppedChanges int                     `json:"droppedChanges"`
+	// UnhealthyReleases are failed or pending. They are also in ExistingReleases.
+	UnhealthyReleases []*UnhealthyReleaseForJSON `json:"unhealthyReleases"`
+	ExistingReleases  []*ExistingReleaseForJSON  `json:"existingReleases"`
+}
+
+// ReleaseChangeForJSON is a single operation in a DigestForJSON. The action is one of the
+// actions which complete an operation, e.g. POST_UPGRADE or FAILED_INSTALL.
+type ReleaseChangeForJSON struct {
+	AppName              string    `json:"appName"`
+	Namespace            string    `json:"namespace"`
+	Cluster              string    `json:"cluster,omitempty"`
+	Action               string    `json:"action"`
+	ChartVersion         string    `json:"chartVersion"`
+	PreviousChartVersion string    `json:"previousChartVersion"`
+	AppVersion           string    `json:"appVersion"`
+	Revision             int       `json:"revision"`
+	At                   time.Time `json:"at"`
+}
+
+// UnhealthyReleaseForJSON is a release in a DigestForJSON which is failed or pending.
+type UnhealthyReleaseForJSON struct {
+	AppName      string `json:"appName"`
+	Namespace    string `json:"namespace"`
+	Cluster      string `json:"cluster,omitempty"`
+	Status       string `json:"status"`
+	ChartVersion string `json:"chartVersion"`
+	Revision     int    `json:"revision"`
+}
+
+// ToDigestForJSON creates a DigestForJSON. It holds knowledge such as where to find the message
+// prefix environment variable.
+func ToDigestForJSON(digest *kwrelease.Digest) *DigestForJSON {
+	container := DigestForJSON{
+		Action:            "DIGEST",
+		Since:             digest.Since,
+		Until:             digest.Until,
+		Changes:           make([]*ReleaseChangeForJSON, 0, len(digest.Changes)),
+		DroppedChanges:    digest.DroppedChanges,
+		UnhealthyReleases: make([]*UnhealthyReleaseForJSON, 0),
+		ExistingReleases:  ToExistingReleasesForJSON(digest.Clusters).ExistingReleases,
+	}
+
+	for _, change := range digest.Changes {
+		container.Changes = append(container.Changes, &ReleaseChangeForJSON{
+			AppName:              change.Name,
+			Namespace:            change.Namespace,
+			Cluster:              change.Cluster,
+			Action:               change.Action.String(),
+			ChartVersion:         change.ChartVersion,
+			PreviousChartVersion: change.PreviousChartVersion,
+			AppVersion:           change.AppVersion,
+			Revision:             change.Revision,
+			At:                   change.At,
+		})
+	}
+
+	for _, cluster := range digest.GetUnhealthyReleases() {
+		for _, release := range cluster.Releases {
+			container.UnhealthyReleases = append(container.UnhealthyReleases, &UnhealthyReleaseForJSON{
+				AppName:      release.Name,
+				Namespace:    release.Namespace,
+				Cluster:      cluster.Cluster,
+				Status:       release.Info.Status.String(),
+				ChartVersion: release.Chart.Metadata.Version,
+				Revision:     release.Version,
+			})
+		}
+	}
+
+	if value, ok := os.LookupEnv("KW_MESSAGE_PREFIX"); ok {
+		container.MessagePrefix = value
+	}
+
+	return &container
+}
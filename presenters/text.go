@@ -6,40 +6,194 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/RoadieHQ/kubewise/kwrelease"
+	"github.com/RoadieHQ/kubewise/utils"
 	"github.com/olekukonko/tablewriter"
 	"helm.sh/helm/v3/pkg/release"
 )
 
+// formatNamespace emphasises the namespace of a release. The cluster is named too when KubeWise
+// watches more than one cluster.
+func formatNamespace(releaseEvent *kwrelease.Event) string {
+	if cluster := releaseEvent.GetClusterName(); cluster != "" {
+		return fmt.Sprintf("*%s* in cluster *%s*", releaseEvent.GetNamespace(), cluster)
+	}
+	return fmt.Sprintf("*%s*", releaseEvent.GetNamespace())
+}
+
+// getChangeInAppVersion compares the app version with the one which is being replaced.
 func getChangeInAppVersion(releaseEvent *kwrelease.Event) string {
-	var appVersion string
-	if releaseEvent.IsAppVersionChanged() {
-		appVersion = fmt.Sprintf("App version will be *%s*, up from %s",
-			releaseEvent.GetAppVersion(),
-			releaseEvent.GetPreviousAppVersion(),
-		)
-	} else {
-		appVersion = fmt.Sprintf("App version will be *%s* (unchanged)",
-			releaseEvent.GetAppVersion(),
-		)
+	replacedAppVersion := releaseEvent.GetReplacedAppVersion()
+	if releaseEvent.GetAppVersion() == replacedAppVersion {
+		return fmt.Sprintf("App version will be *%s* (unchanged)", releaseEvent.GetAppVersion())
+	}
+
+	direction := "up"
+	if releaseEvent.GetRollbackRevision() > 0 {
+		direction = "rolled back"
+	}
+	return fmt.Sprintf("App version will be *%s*, %s from %s",
+		releaseEvent.GetAppVersion(),
+		direction,
+		replacedAppVersion,
+	)
+}
+
+// The chart values diff can be shown as a unified diff of the values YAML or as a list of the
+// values which changed, by path. The unified diff is the default because it is what the chart
+// values diff has always shown.
+const (
+	configDiffFormatPaths   = "paths"
+	configDiffFormatUnified = "unified"
+	maxConfigDiffLines      = 30
+)
+
+func isConfigDiffEnabled() bool {
+	return utils.GetEnvBool("KW_CHART_VALUES_DIFF_ENABLED", false)
+}
+
+func getConfigDiffFormat() string {
+	switch format := strings.ToLower(os.Getenv("KW_CHART_VALUES_DIFF_FORMAT")); format {
+	case "", configDiffFormatUnified:
+		return configDiffFormatUnified
+	case configDiffFormatPaths:
+		return configDiffFormatPaths
+	default:
+		log.Println("Invalid value passed for environment variable KW_CHART_VALUES_DIFF_FORMAT. Options are paths or unified. Defaulting to unified.")
+		return configDiffFormatUnified
+	}
+}
+
+// getChangeInRevision names the Helm revisions involved in an operation, e.g. revision 6 which
+// replaces revision 5, or revision 6 which restores revision 3 and replaces revision 5.
+func getChangeInRevision(releaseEvent *kwrelease.Event) string {
+	revision := fmt.Sprintf("Revision *%d*", releaseEvent.GetRevision())
+	if rollbackRevision := releaseEvent.GetRollbackRevision(); rollbackRevision > 0 {
+		revision += fmt.Sprintf(" restores revision *%d*", rollbackRevision)
+		if replacedRevision := releaseEvent.GetReplacedRevision(); replacedRevision > 0 {
+			revision += fmt.Sprintf(" and replaces revision %d", replacedRevision)
+		}
+	} else if previousRevision := releaseEvent.GetPreviousRevision(); previousRevision > 0 {
+		revision += fmt.Sprintf(" replaces revision %d", previousRevision)
 	}
-	return appVersion
+	return revision + "."
 }
 
 func getConfigDiff(releaseEvent *kwrelease.Event) string {
-	showDiff, err := strconv.ParseBool(os.Getenv("KW_CHART_VALUES_DIFF_ENABLED"))
+	if !isConfigDiffEnabled() {
+		return ""
+	}
+
+	if getConfigDiffFormat() == configDiffFormatUnified {
+		if configDiffYAML := releaseEvent.GetConfigDiffYAML(); configDiffYAML != "" {
+			return fmt.Sprintf("\n```%s```", configDiffYAML)
+		}
+		return ""
+	}
+
+	changes := releaseEvent.GetConfigDiff()
+	if len(changes) == 0 {
+		return ""
+	}
+
+	lines := make([]string, 0, len(changes))
+	for _, change := range changes {
+		lines = append(lines, describeValueChange(change))
+	}
+	if len(lines) > maxConfigDiffLines {
+		more := len(lines) - maxConfigDiffLines
+		lines = append(lines[:maxConfigDiffLines], fmt.Sprintf("…and %d more", more))
+	}
+
+	return fmt.Sprintf("\n```%s```", strings.Join(lines, "\n"))
+}
+
+// describeValueChange shows a change on one line, e.g. image.tag: 1.2.3 → 1.2.4 or
+// + ingress.hosts[1]: example.com
+func describeValueChange(change *kwrelease.ValueChange) string {
+	switch change.Op {
+	case kwrelease.DiffOpAdd:
+		return fmt.Sprintf("+ %s: %s", change.Path, kwrelease.FormatValue(change.New))
+	case kwrelease.DiffOpRemove:
+		return fmt.Sprintf("- %s: %s", change.Path, kwrelease.FormatValue(change.Old))
+	}
+	return fmt.Sprintf("%s: %s → %s", change.Path, kwrelease.FormatValue(change.Old), kwrelease.FormatValue(change.New))
+}
+
+// maxManifestDiffLines limits the number of objects which are listed in a chat message, and
+// maxManifestDiffPaths the number of fields listed for each of them. The webhook payload holds
+// the whole diff.
+const (
+	maxManifestDiffLines = 20
+	maxManifestDiffPaths = 3
+)
+
+var manifestChangeSymbols = map[kwrelease.ManifestChange]string{
+	kwrelease.ManifestAdded:    "+",
+	kwrelease.ManifestRemoved:  "-",
+	kwrelease.ManifestModified: "~",
+}
+
+// getManifestDiff summarises the Kubernetes objects which the operation will add, remove or
+// modify. Each modified object lists the first few of its fields which changed.
+func getManifestDiff(releaseEvent *kwrelease.Event) string {
+	if !isManifestDiffEnabled() {
+		return ""
+	}
+
+	diff := releaseEvent.GetManifestDiff()
+	if diff == nil || len(diff.Resources) == 0 {
+		return ""
+	}
+
+	lines := []string{}
+	for _, resource := range diff.Resources {
+		line := manifestChangeSymbols[resource.Change] + " " + resource.Kind + "/" + resource.Name
+		if resource.Namespace != releaseEvent.GetNamespace() {
+			line = manifestChangeSymbols[resource.Change] + " " + resource.Kind + "/" + resource.Namespace + "/" + resource.Name
+		}
+
+		if len(resource.Fields) > 0 {
+			paths := []string{}
+			for i, field := range resource.Fields {
+				if i == maxManifestDiffPaths {
+					paths = append(paths, fmt.Sprintf("and %d more", len(resource.Fields)-maxManifestDiffPaths))
+					break
+				}
+				paths = append(paths, field.Path)
+			}
+			line += ": " + strings.Join(paths, ", ")
+		}
 
-	if err != nil {
-		log.Println("Invalid value passed for environment variable KW_CHART_VALUES_DIFF_ENABLED. Boolean required.")
+		lines = append(lines, line)
 	}
 
-	configDiffYAML := releaseEvent.GetConfigDiffYAML()
-	if showDiff && configDiffYAML != "" {
-		return fmt.Sprintf("\n```%s```", configDiffYAML)
+	if len(lines) > maxManifestDiffLines {
+		more := len(lines) - maxManifestDiffLines
+		lines = append(lines[:maxManifestDiffLines], fmt.Sprintf("…and %d more", more))
 	}
 
-	return ""
+	return fmt.Sprintf("\n🧩 Kubernetes objects: *%d* added, *%d* modified, *%d* removed.\n```%s```",
+		diff.Count(kwrelease.ManifestAdded),
+		diff.Count(kwrelease.ManifestModified),
+		diff.Count(kwrelease.ManifestRemoved),
+		strings.Join(lines, "\n"),
+	)
+}
+
+func isManifestDiffEnabled() bool {
+	return utils.GetEnvBool("KW_MANIFEST_DIFF_ENABLED", false)
+}
+
+// formatDuration rounds a duration so that it reads naturally, e.g. 1m23s rather than
+// 1m23.456789s.
+func formatDuration(duration time.Duration) string {
+	if duration < time.Second {
+		return duration.Round(time.Millisecond).String()
+	}
+	return duration.Round(time.Second).String()
 }
 
 // PrepareMsg prepares a short, markdown-like message which is suitable for sending to chat
@@ -50,97 +204,155 @@ func PrepareMsg(releaseEvent *kwrelease.Event) string {
 
 	switch releaseEvent.GetAction() {
 	case kwrelease.ActionPreInstall:
-		msg += fmt.Sprintf("📀 Installing *%s* version *%s* into namespace *%s* via Helm. ⏳\n\nApp version: *%s*\n%s",
+		msg += fmt.Sprintf("📀 Installing *%s* version *%s* into namespace %s via Helm. ⏳\n\nApp version: *%s*\n%s",
 			releaseEvent.GetAppName(),
 			releaseEvent.GetChartVersion(),
-			releaseEvent.GetNamespace(),
+			formatNamespace(releaseEvent),
 			releaseEvent.GetAppVersion(),
 			releaseEvent.GetAppDescription(),
 		)
 
 	case kwrelease.ActionPreUpgrade:
-		msg += fmt.Sprintf("⏫ Upgrading *%s* from version %s to version *%s* in namespace *%s* via Helm. ⏳\n%s",
+		msg += fmt.Sprintf("⏫ Upgrading *%s* from version %s to version *%s* in namespace %s via Helm. ⏳\n%s\n%s",
 			releaseEvent.GetAppName(),
 			releaseEvent.GetPreviousChartVersion(),
 			releaseEvent.GetChartVersion(),
-			releaseEvent.GetNamespace(),
+			formatNamespace(releaseEvent),
 			getChangeInAppVersion(releaseEvent),
+			getChangeInRevision(releaseEvent),
 		)
 
 		if configDiff := getConfigDiff(releaseEvent); configDiff != "" {
 			msg += configDiff
 		}
 
+		if manifestDiff := getManifestDiff(releaseEvent); manifestDiff != "" {
+			msg += manifestDiff
+		}
+
 	case kwrelease.ActionPreRollback:
-		msg += fmt.Sprintf("⏬ Rolling back *%s* from version %s to version *%s* in namespace *%s* via Helm. ⏳\n%s",
+		// A rollback restores the chart values and manifest of an earlier revision, and is
+		// compared with it, so there is no diff to show.
+		msg += fmt.Sprintf("⏬ Rolling back *%s* from version %s to version *%s* in namespace %s via Helm. ⏳\n%s\n%s",
 			releaseEvent.GetAppName(),
-			releaseEvent.GetPreviousChartVersion(),
+			releaseEvent.GetReplacedChartVersion(),
 			releaseEvent.GetChartVersion(),
-			releaseEvent.GetNamespace(),
+			formatNamespace(releaseEvent),
 			getChangeInAppVersion(releaseEvent),
+			getChangeInRevision(releaseEvent),
 		)
 
-		if configDiff := getConfigDiff(releaseEvent); configDiff != "" {
-			msg += configDiff
-		}
-
 	case kwrelease.ActionPreUninstall:
-		msg += fmt.Sprintf("🧼 Uninstalling *%s* from namespace *%s* via Helm. ⏳",
+		msg += fmt.Sprintf("🧼 Uninstalling *%s* from namespace %s via Helm. ⏳",
 			releaseEvent.GetAppName(),
-			releaseEvent.GetNamespace(),
+			formatNamespace(releaseEvent),
 		)
 
+	case kwrelease.ActionPostUninstall:
+		// The chart version is unknown when only the metadata of the release was available.
+		if releaseEvent.GetChartVersion() == "" {
+			msg += fmt.Sprintf("🧼 Uninstalled *%s* from namespace %s via Helm. ✅",
+				releaseEvent.GetAppName(),
+				formatNamespace(releaseEvent),
+			)
+		} else {
+			msg += fmt.Sprintf("🧼 Uninstalled *%s* version *%s* from namespace %s via Helm. ✅",
+				releaseEvent.GetAppName(),
+				releaseEvent.GetChartVersion(),
+				formatNamespace(releaseEvent),
+			)
+		}
+
 	case kwrelease.ActionPostInstall:
-		msg += fmt.Sprintf("📀 Installed *%s* version *%s* into namespace *%s* via Helm. ✅\n\n```%s```",
+		msg += fmt.Sprintf("📀 Installed *%s* version *%s* into namespace %s via Helm. ✅\n\n```%s```",
 			releaseEvent.GetAppName(),
 			releaseEvent.GetChartVersion(),
-			releaseEvent.GetNamespace(),
+			formatNamespace(releaseEvent),
 			releaseEvent.GetNotes(),
 		)
 
 	case kwrelease.ActionPostUpgrade:
-		msg += fmt.Sprintf("⏫ Upgraded *%s* from version %s to version *%s* in namespace *%s* via Helm. ✅",
+		msg += fmt.Sprintf("⏫ Upgraded *%s* from version %s to version *%s* in namespace %s via Helm. ✅\n%s",
 			releaseEvent.GetAppName(),
 			releaseEvent.GetPreviousChartVersion(),
 			releaseEvent.GetChartVersion(),
-			releaseEvent.GetNamespace(),
+			formatNamespace(releaseEvent),
+			getChangeInRevision(releaseEvent),
 		)
 
 	case kwrelease.ActionPostRollback:
-		msg += fmt.Sprintf("⏬ Rolled back *%s* from version %s to version *%s* in namespace *%s* via Helm. ✅",
+		msg += fmt.Sprintf("⏬ Rolled back *%s* from version %s to version *%s* in namespace %s via Helm. ✅\n%s",
 			releaseEvent.GetAppName(),
-			releaseEvent.GetPreviousChartVersion(),
+			releaseEvent.GetReplacedChartVersion(),
 			releaseEvent.GetChartVersion(),
-			releaseEvent.GetNamespace(),
+			formatNamespace(releaseEvent),
+			getChangeInRevision(releaseEvent),
 		)
 
 	case kwrelease.ActionPostReplace:
-		msg += fmt.Sprintf("Replaced *%s* version %s with version *%s* in namespace *%s* via Helm. ✅",
+		msg += fmt.Sprintf("Replaced *%s* version %s with version *%s* in namespace %s via Helm. ✅\n%s",
 			releaseEvent.GetAppName(),
 			releaseEvent.GetPreviousChartVersion(),
 			releaseEvent.GetChartVersion(),
-			releaseEvent.GetNamespace(),
+			formatNamespace(releaseEvent),
+			getChangeInRevision(releaseEvent),
 		)
 
 	case kwrelease.ActionFailedInstall:
-		msg += fmt.Sprintf("❌ Installation of *%s* version *%s* in namespace *%s* has FAILED. ❌\n\n```%s```",
+		msg += fmt.Sprintf("❌ Installation of *%s* version *%s* in namespace %s has FAILED. ❌\n\n```%s```",
 			releaseEvent.GetAppName(),
 			releaseEvent.GetChartVersion(),
-			releaseEvent.GetNamespace(),
+			formatNamespace(releaseEvent),
 			// This has the cause of the failure.
 			releaseEvent.GetReleaseDescription(),
 		)
 
 	case kwrelease.ActionFailedReplace:
-		msg += fmt.Sprintf("❌ Replacing *%s* version %s with version *%s* in namespace *%s* has FAILED. ❌\n\n```%s```",
+		msg += fmt.Sprintf("❌ Replacing *%s* version %s with version *%s* in namespace %s has FAILED. ❌\n\n```%s```",
 			releaseEvent.GetAppName(),
 			releaseEvent.GetPreviousChartVersion(),
 			releaseEvent.GetChartVersion(),
-			releaseEvent.GetNamespace(),
+			formatNamespace(releaseEvent),
 			releaseEvent.GetReleaseDescription(),
 		)
 	}
 
+	if details := releaseEvent.GetFailureDetails(); details != nil {
+		msg += describeFailureDetails(details)
+	}
+
+	if duration := releaseEvent.GetDuration(); duration > 0 {
+		msg += fmt.Sprintf("\n\n⏱️ Took *%s*.", formatDuration(duration))
+	}
+
+	return msg
+}
+
+// describeFailureDetails shows the end of the logs of each failed hook followed by the
+// warnings which Kubernetes recorded while the operation was running.
+func describeFailureDetails(details *kwrelease.FailureDetails) string {
+	msg := ""
+	for _, podLogs := range details.HookLogs {
+		msg += fmt.Sprintf("\n\n🪝 Logs of hook *%s*, pod %s, container %s:\n```%s```",
+			podLogs.Hook,
+			podLogs.Pod,
+			podLogs.Container,
+			podLogs.Logs,
+		)
+	}
+
+	if len(details.Events) > 0 {
+		events := ""
+		for _, event := range details.Events {
+			events += fmt.Sprintf("%s/%s %s: %s", event.Kind, event.Name, event.Reason, event.Message)
+			if event.Count > 1 {
+				events += fmt.Sprintf(" (x%d)", event.Count)
+			}
+			events += "\n"
+		}
+		msg += fmt.Sprintf("\n\n⚠️ Recent warnings:\n```%s```", strings.TrimSuffix(events, "\n"))
+	}
+
 	return msg
 }
 
@@ -157,12 +369,32 @@ func initializeServerStartupMsg() string {
 // PrepareServerStartupMsg prepares a message which is suitable for sending to a chat application
 // like Slack on server startup. The message will contain information about the Helm charts that
 // are installed in the cluster at the time of install. They will be presented in a monospaced
-// table.
-func PrepareServerStartupMsg(releases []*release.Release) string {
+// table. When KubeWise watches more than one cluster, there is a table for each cluster.
+func PrepareServerStartupMsg(clusters []*kwrelease.ClusterReleases) string {
 	msg := initializeServerStartupMsg()
-	numberOfReleases := len(releases)
 	msg += "👋 KubeWise initialized."
 
+	if len(clusters) == 1 && clusters[0].Cluster == "" {
+		return msg + describeInstalledCharts(clusters[0].Releases)
+	}
+
+	if len(clusters) == 1 {
+		msg += " Watching *1* cluster."
+	} else {
+		msg += fmt.Sprintf(" Watching *%s* clusters.", strconv.Itoa(len(clusters)))
+	}
+
+	for _, cluster := range clusters {
+		msg += fmt.Sprintf("\n\n*%s*:%s", cluster.Cluster, describeInstalledCharts(cluster.Releases))
+	}
+
+	return msg
+}
+
+func describeInstalledCharts(releases []*release.Release) string {
+	var msg string
+	numberOfReleases := len(releases)
+
 	if numberOfReleases == 1 {
 		msg += " There is *1* Helm chart installed."
 	} else {
@@ -178,11 +410,18 @@ func PrepareServerStartupMsg(releases []*release.Release) string {
 	return msg
 }
 
+// PrepareServerShutdownMsg prepares a message which is suitable for sending to a chat
+// application like Slack when KubeWise shuts down.
+func PrepareServerShutdownMsg() string {
+	return initializeServerStartupMsg() + "👋 KubeWise shutting down."
+}
+
 func renderTableShowingInstalledCharts(releases []*release.Release) string {
 	data := make([][]string, len(releases))
 	for i, release := range releases {
 		data[i] = []string{
 			release.Name,
+			release.Namespace,
 			release.Chart.AppVersion(),
 			release.Chart.Metadata.Version,
 		}
@@ -190,7 +429,275 @@ func renderTableShowingInstalledCharts(releases []*release.Release) string {
 
 	tableString := &strings.Builder{}
 	table := tablewriter.NewWriter(tableString)
-	table.SetHeader([]string{"App Name", "App Version", "Chart Version"})
+	table.SetHeader([]string{"App Name", "Namespace", "App Version", "Chart Version"})
+	table.SetBorder(false)
+	table.AppendBulk(data)
+	table.Render()
+
+	return tableString.String()
+}
+
+// PrepareStuckReleaseMsg prepares a message about a release which has been pending for too long,
+// or which has settled after an alert was sent about it.
+func PrepareStuckReleaseMsg(stuck *kwrelease.StuckRelease) string {
+	msg := initializeServerStartupMsg()
+
+	if stuck.Resolution != nil {
+		msg += fmt.Sprintf("✅ *%s* in namespace %s is no longer stuck. It was %s for %s and is now *%s*.",
+			stuck.Event.GetAppName(),
+			formatNamespace(stuck.Event),
+			stuck.Event.GetStatus(),
+			stuck.GetPendingDuration(),
+			stuck.GetResolvedStatus(),
+		)
+		return msg
+	}
+
+	msg += fmt.Sprintf("⚠️ *%s* in namespace %s has been *%s* for *%s*. ⚠️\n\nHelm may have been interrupted. Further operations on the release will fail with \"another operation is in progress\" until it is rolled back.",
+		stuck.Event.GetAppName(),
+		formatNamespace(stuck.Event),
+		stuck.Event.GetStatus(),
+		stuck.GetPendingDuration(),
+	)
+	return msg
+}
+
+// describeWorkload summarises the rollout of a workload, e.g.
+// "Deployment payments-api: 0/3 ready, ImagePullBackOff".
+func describeWorkload(workload *kwrelease.WorkloadStatus) string {
+	description := fmt.Sprintf("%s %s: %d/%d ready", workload.Kind, workload.Name, workload.Ready, workload.Desired)
+	if workload.Reason != "" {
+		description += ", " + workload.Reason
+	}
+	return description
+}
+
+// PrepareRolloutStatusMsg prepares a message about whether the pods in a release came up after
+// it was deployed.
+func PrepareRolloutStatusMsg(rollout *kwrelease.RolloutStatus) string {
+	msg := initializeServerStartupMsg()
+	numberOfWorkloads := len(rollout.Workloads)
+
+	if rollout.IsHealthy() {
+		if numberOfWorkloads == 1 {
+			msg += fmt.Sprintf("💚 *%s* version *%s* rolled out in namespace %s. The workload is healthy.",
+				rollout.Event.GetAppName(),
+				rollout.Event.GetChartVersion(),
+				formatNamespace(rollout.Event),
+			)
+		} else {
+			msg += fmt.Sprintf("💚 *%s* version *%s* rolled out in namespace %s. All %d workloads are healthy.",
+				rollout.Event.GetAppName(),
+				rollout.Event.GetChartVersion(),
+				formatNamespace(rollout.Event),
+				numberOfWorkloads,
+			)
+		}
+		return msg
+	}
+
+	unhealthy := rollout.GetUnhealthyWorkloads()
+	descriptions := make([]string, len(unhealthy))
+	for i, workload := range unhealthy {
+		descriptions[i] = describeWorkload(workload)
+	}
+
+	msg += fmt.Sprintf("🚨 *%s* version *%s* has NOT rolled out in namespace %s after %s. %d of %d workloads are unhealthy. 🚨\n\n```%s```",
+		rollout.Event.GetAppName(),
+		rollout.Event.GetChartVersion(),
+		formatNamespace(rollout.Event),
+		formatDuration(rollout.WatchedFor),
+		len(unhealthy),
+		numberOfWorkloads,
+		strings.Join(descriptions, "\n"),
+	)
+	return msg
+}
+
+// PrepareTestRunMsg prepares a message listing the results of running helm test against a
+// release. Each test hook is shown with its phase and how long it took in a monospaced table.
+func PrepareTestRunMsg(testRun *kwrelease.TestRun) string {
+	msg := initializeServerStartupMsg()
+
+	if testRun.IsSuccessful() {
+		msg += fmt.Sprintf("🧪 Tests of *%s* version *%s* in namespace %s PASSED. ✅",
+			testRun.Event.GetAppName(),
+			testRun.Event.GetChartVersion(),
+			formatNamespace(testRun.Event),
+		)
+	} else {
+		msg += fmt.Sprintf("🧪 Tests of *%s* version *%s* in namespace %s have FAILED. ❌",
+			testRun.Event.GetAppName(),
+			testRun.Event.GetChartVersion(),
+			formatNamespace(testRun.Event),
+		)
+	}
+
+	data := make([][]string, len(testRun.Results))
+	for i, result := range testRun.Results {
+		data[i] = []string{
+			result.Name,
+			result.Phase.String(),
+			formatDuration(result.GetDuration()),
+		}
+	}
+
+	tableString := &strings.Builder{}
+	table := tablewriter.NewWriter(tableString)
+	table.SetHeader([]string{"Test", "Phase", "Duration"})
+	table.SetBorder(false)
+	table.AppendBulk(data)
+	table.Render()
+
+	msg += fmt.Sprintf("\n\n```%s```", tableString.String())
+	return msg
+}
+
+// maxDriftLines limits the number of drifted fields which are listed in a chat message. The
+// webhook payload lists every field.
+const maxDriftLines = 20
+
+// PrepareReleaseDriftMsg lists the objects in a release which have been changed outside Helm.
+func PrepareReleaseDriftMsg(drift *kwrelease.ReleaseDrift) string {
+	msg := initializeServerStartupMsg()
+
+	msg += fmt.Sprintf("🔀 *%s* version *%s* in namespace %s has drifted from its Helm manifest. %d fields were changed outside Helm. ⚠️",
+		drift.Event.GetAppName(),
+		drift.Event.GetChartVersion(),
+		formatNamespace(drift.Event),
+		drift.GetFieldCount(),
+	)
+
+	lines := []string{}
+	for _, resource := range drift.Resources {
+		name := resource.Kind + "/" + resource.Name
+		if resource.Namespace != drift.Event.GetNamespace() {
+			name = resource.Kind + "/" + resource.Namespace + "/" + resource.Name
+		}
+
+		if resource.Missing {
+			lines = append(lines, name+" has been deleted")
+			continue
+		}
+		for _, field := range resource.Fields {
+			lines = append(lines, fmt.Sprintf("%s %s: %s → %s", name, field.Path, describeDriftValue(field.Expected), describeDriftValue(field.Live)))
+		}
+	}
+
+	if len(lines) > maxDriftLines {
+		more := len(lines) - maxDriftLines
+		lines = append(lines[:maxDriftLines], fmt.Sprintf("…and %d more", more))
+	}
+
+	msg += fmt.Sprintf("\n\n```%s```", strings.Join(lines, "\n"))
+	return msg
+}
+
+func describeDriftValue(value string) string {
+	if value == "" {
+		return "(none)"
+	}
+	return value
+}
+
+// digestChanges describes each kind of change in a digest.
+var digestChanges = map[kwrelease.Action]string{
+	kwrelease.ActionPostInstall:   "Installed",
+	kwrelease.ActionPostUpgrade:   "Upgraded",
+	kwrelease.ActionPostRollback:  "Rolled back",
+	kwrelease.ActionPostReplace:   "Replaced",
+	kwrelease.ActionPostUninstall: "Uninstalled",
+	kwrelease.ActionFailedInstall: "FAILED install",
+	kwrelease.ActionFailedReplace: "FAILED upgrade",
+}
+
+// PrepareDigestMsg prepares the scheduled digest. It lists the changes since the last digest,
+// the releases which need attention and then every installed release, like the startup message.
+func PrepareDigestMsg(digest *kwrelease.Digest) string {
+	const timeFormat = "Mon 2 Jan 15:04 MST"
+	multiCluster := len(digest.Clusters) > 1 || (len(digest.Clusters) == 1 && digest.Clusters[0].Cluster != "")
+
+	msg := initializeServerStartupMsg()
+	msg += fmt.Sprintf("📰 KubeWise digest from %s to %s.",
+		digest.Since.Format(timeFormat),
+		digest.Until.Format(timeFormat),
+	)
+
+	numberOfChanges := len(digest.Changes) + digest.DroppedChanges
+	switch numberOfChanges {
+	case 0:
+		msg += "\n\nThere have been no Helm operations."
+	case 1:
+		msg += "\n\nThere has been *1* Helm operation."
+	default:
+		msg += fmt.Sprintf("\n\nThere have been *%d* Helm operations.", numberOfChanges)
+	}
+	if digest.DroppedChanges > 0 {
+		msg += fmt.Sprintf(" Only the first %d are listed.", len(digest.Changes))
+	}
+
+	if len(digest.Changes) > 0 {
+		header := []string{"App Name", "Namespace", "Change", "Chart Version", "When"}
+		if multiCluster {
+			header = append([]string{"Cluster"}, header...)
+		}
+
+		data := make([][]string, len(digest.Changes))
+		for i, change := range digest.Changes {
+			chartVersion := change.ChartVersion
+			if change.PreviousChartVersion != "" && change.PreviousChartVersion != change.ChartVersion {
+				chartVersion = change.PreviousChartVersion + " → " + change.ChartVersion
+			}
+			data[i] = []string{change.Name, change.Namespace, digestChanges[change.Action], chartVersion, change.At.Format(timeFormat)}
+			if multiCluster {
+				data[i] = append([]string{change.Cluster}, data[i]...)
+			}
+		}
+
+		msg += fmt.Sprintf("```%s```", renderDigestTable(header, data))
+	}
+
+	unhealthy := digest.GetUnhealthyReleases()
+	if len(unhealthy) > 0 {
+		header := []string{"App Name", "Namespace", "Status", "Chart Version"}
+		if multiCluster {
+			header = append([]string{"Cluster"}, header...)
+		}
+
+		data := [][]string{}
+		for _, cluster := range unhealthy {
+			for _, release := range cluster.Releases {
+				row := []string{release.Name, release.Namespace, release.Info.Status.String(), release.Chart.Metadata.Version}
+				if multiCluster {
+					row = append([]string{cluster.Cluster}, row...)
+				}
+				data = append(data, row)
+			}
+		}
+
+		if len(data) == 1 {
+			msg += "\n\n⚠️ *1* release is failed or pending."
+		} else {
+			msg += fmt.Sprintf("\n\n⚠️ *%d* releases are failed or pending.", len(data))
+		}
+		msg += fmt.Sprintf("```%s```", renderDigestTable(header, data))
+	}
+
+	if !multiCluster && len(digest.Clusters) == 1 {
+		return msg + "\n\n" + strings.TrimSpace(describeInstalledCharts(digest.Clusters[0].Releases))
+	}
+
+	for _, cluster := range digest.Clusters {
+		msg += fmt.Sprintf("\n\n*%s*:%s", cluster.Cluster, describeInstalledCharts(cluster.Releases))
+	}
+
+	return msg
+}
+
+func renderDigestTable(header []string, data [][]string) string {
+	tableString := &strings.Builder{}
+	table := tablewriter.NewWriter(tableString)
+	table.SetHeader(header)
 	table.SetBorder(false)
 	table.AppendBulk(data)
 	table.Render()
@@ -0,0 +1,161 @@
+package replay
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/RoadieHQ/kubewise/kwrelease"
+	rspb "helm.sh/helm/v3/pkg/release"
+	api_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// storedRelease is a Helm release Secret or ConfigMap which was read from a file, along with
+// the release it holds.
+type storedRelease struct {
+	secret    *api_v1.Secret
+	configMap *api_v1.ConfigMap
+	release   *rspb.Release
+}
+
+func (s *storedRelease) object() meta_v1.Object {
+	if s.configMap != nil {
+		return s.configMap
+	}
+	return s.secret
+}
+
+// loadFiles reads the Helm release Secrets and ConfigMaps in YAML or JSON files, such as the
+// output of kubectl get secret -o yaml. Files may hold a single object, a List or several YAML
+// documents. Other kinds of object are skipped. The releases are returned in revision order.
+func loadFiles(paths []string) ([]*storedRelease, error) {
+	// The same object may be in more than one file. The last copy wins.
+	byKey := make(map[string]*storedRelease)
+
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+
+		stored, err := decodeObjects(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", path, err)
+		}
+
+		for _, s := range stored {
+			byKey[s.object().GetNamespace()+"/"+s.object().GetName()] = s
+		}
+	}
+
+	releases := make([]*storedRelease, 0, len(byKey))
+	for _, s := range byKey {
+		releases = append(releases, s)
+	}
+
+	sort.Slice(releases, func(i, j int) bool {
+		a, b := releases[i].release, releases[j].release
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Version < b.Version
+	})
+
+	return releases, nil
+}
+
+func decodeObjects(reader io.Reader) ([]*storedRelease, error) {
+	decoder := yaml.NewYAMLOrJSONDecoder(reader, 4096)
+
+	var stored []*storedRelease
+	for {
+		var document map[string]interface{}
+		err := decoder.Decode(&document)
+		if err == io.EOF {
+			return stored, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		objects := []interface{}{document}
+		if items, ok := document["items"].([]interface{}); ok {
+			objects = items
+		}
+
+		for _, object := range objects {
+			s, err := decodeObject(object)
+			if err != nil {
+				return nil, err
+			}
+			if s != nil {
+				stored = append(stored, s)
+			}
+		}
+	}
+}
+
+// decodeObject turns a decoded Secret or ConfigMap into a storedRelease. It returns nil for
+// objects which do not hold a Helm release.
+func decodeObject(object interface{}) (*storedRelease, error) {
+	fields, ok := object.(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+
+	// Round tripping through JSON lets the Kubernetes types decode themselves, including the
+	// base64 encoded data of Secrets.
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := &storedRelease{}
+	var data string
+
+	switch fields["kind"] {
+	case "Secret":
+		stored.secret = &api_v1.Secret{}
+		if err := json.Unmarshal(encoded, stored.secret); err != nil {
+			return nil, err
+		}
+		if stored.secret.Type != "helm.sh/release.v1" {
+			return nil, nil
+		}
+		data = string(stored.secret.Data["release"])
+
+	case "ConfigMap":
+		stored.configMap = &api_v1.ConfigMap{}
+		if err := json.Unmarshal(encoded, stored.configMap); err != nil {
+			return nil, err
+		}
+		if stored.configMap.GetLabels()["owner"] != "helm" {
+			return nil, nil
+		}
+		data = stored.configMap.Data["release"]
+
+	default:
+		return nil, nil
+	}
+
+	stored.release, err = kwrelease.DecodeRelease(data)
+	if err != nil {
+		// Do NOT include the err. It may quote the release, which can contain secrets.
+		return nil, fmt.Errorf("unable to decode the release in %s", stored.object().GetName())
+	}
+
+	// Dumps taken with kubectl get -n are sometimes stripped of their namespace.
+	if stored.object().GetNamespace() == "" {
+		stored.object().SetNamespace(stored.release.Namespace)
+	}
+
+	return stored, nil
+}
@@ -0,0 +1,205 @@
+// Package replay feeds Helm releases which were recorded from a cluster through the same
+// pipeline that KubeWise uses for a live cluster. It is used to work on presenters and handlers
+// without a cluster or real Helm operations.
+package replay
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/RoadieHQ/kubewise/handlers"
+	"github.com/RoadieHQ/kubewise/kwrelease"
+	"github.com/RoadieHQ/kubewise/utils"
+	rspb "helm.sh/helm/v3/pkg/release"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const usage = `Usage: kubewise replay [flags] FILE...
+
+Replays the Helm release Secrets or ConfigMaps in YAML or JSON files through a handler, in
+revision order. The files can be created with, for example:
+
+  kubectl get secret -A -l owner=helm -o yaml > releases.yaml
+
+Flags:
+`
+
+// Main runs the replay command with the arguments which follow "replay" and returns the exit
+// code. newHandler creates the handler with the given name, e.g. stdout or slack.
+func Main(args []string, newHandler func(name string) handlers.Handler) int {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	handlerName := flags.String("handler", "stdout", "The handler to send messages with: stdout, slack, googlechat or webhook. The handler is configured with the usual KW_* environment variables.")
+	clusterName := flags.String("cluster", os.Getenv("KW_CLUSTER_NAME"), "The name of the cluster which the releases were recorded from.")
+	skipPending := flags.Bool("skip-pending", false, "Only replay the state each revision settled in, not the pending state which Helm records while the operation runs.")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	switch *handlerName {
+	case "stdout", "slack", "googlechat", "webhook":
+	default:
+		log.Println("Unknown handler", *handlerName+". Options are stdout, slack, googlechat or webhook.")
+		return 2
+	}
+
+	releases, err := loadFiles(flags.Args())
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	if len(releases) == 0 {
+		log.Println("No Helm releases found in", strings.Join(flags.Args(), ", "))
+		return 1
+	}
+
+	eventHandler := newHandler(*handlerName)
+	eventHandler.Init()
+
+	if err := run(releases, *clusterName, !*skipPending, eventHandler); err != nil {
+		log.Println(err)
+		return 1
+	}
+	return 0
+}
+
+// run replays releases through a handler. Each revision is stored in a fake cluster in turn,
+// just as Helm would store it, and an Event is built from it exactly as the controller builds
+// one. This means the previous revision is looked up and the action is worked out in the same
+// way as for a live cluster.
+//
+// Only the final state of each revision is recorded, so the state which Helm stored while the
+// operation ran is rebuilt from it when withPending is set. Revisions which have since been
+// superseded are replayed as deployed, which is the state they were in before the next
+// operation. Operation durations can not be recovered and are left out.
+func run(releases []*storedRelease, clusterName string, withPending bool, eventHandler handlers.Handler) error {
+	client := fake.NewSimpleClientset()
+	cluster := utils.NewClusterWithClient(clusterName, client)
+
+	for _, stored := range releases {
+		states := []*rspb.Release{}
+		if withPending {
+			if pending := getPendingState(stored.release); pending != nil {
+				states = append(states, pending)
+			}
+		}
+		if settled := getSettledState(stored.release); settled != nil {
+			states = append(states, settled)
+		}
+
+		for _, state := range states {
+			releaseEvent, err := storeRelease(client, cluster, stored, state)
+			if err != nil {
+				return err
+			}
+			if releaseEvent.Init() != nil {
+				continue
+			}
+			if releaseEvent.GetAction() == kwrelease.ActionPostReplaceSuperseded {
+				continue
+			}
+
+			eventHandler.HandleEvent(releaseEvent)
+		}
+	}
+
+	return nil
+}
+
+// getPendingState returns the revision as Helm stored it while the operation was running. It
+// returns nil for revisions which have not settled yet, because their recorded state is the
+// pending state.
+func getPendingState(release *rspb.Release) *rspb.Release {
+	var status rspb.Status
+	switch release.Info.Status {
+	case rspb.StatusDeployed, rspb.StatusSuperseded, rspb.StatusFailed:
+		if strings.HasPrefix(release.Info.Description, "Rollback") {
+			status = rspb.StatusPendingRollback
+		} else if release.Version > 1 {
+			status = rspb.StatusPendingUpgrade
+		} else {
+			status = rspb.StatusPendingInstall
+		}
+	case rspb.StatusUninstalled:
+		status = rspb.StatusUninstalling
+	default:
+		return nil
+	}
+
+	return withStatus(release, status)
+}
+
+// getSettledState returns the state which the revision settled in.
+func getSettledState(release *rspb.Release) *rspb.Release {
+	if release.Info.Status == rspb.StatusSuperseded {
+		return withStatus(release, rspb.StatusDeployed)
+	}
+	return release
+}
+
+func withStatus(release *rspb.Release, status rspb.Status) *rspb.Release {
+	info := *release.Info
+	info.Status = status
+
+	copied := *release
+	copied.Info = &info
+	return &copied
+}
+
+// storeRelease writes a state of a revision to the fake cluster and returns an Event for the
+// update, as the informer would deliver it.
+func storeRelease(client kubernetes.Interface, cluster *utils.Cluster, stored *storedRelease, release *rspb.Release) (*kwrelease.Event, error) {
+	data, err := kwrelease.EncodeRelease(release)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode release %s", stored.object().GetName())
+	}
+
+	releaseEvent := &kwrelease.Event{SecretAction: "update", Cluster: cluster}
+
+	if stored.configMap != nil {
+		configMap := stored.configMap.DeepCopy()
+		configMap.Data["release"] = data
+		setStatusLabel(configMap.Labels, release.Info.Status)
+
+		configMaps := client.CoreV1().ConfigMaps(configMap.Namespace)
+		if _, err := configMaps.Update(configMap); err != nil {
+			if _, err := configMaps.Create(configMap); err != nil {
+				return nil, err
+			}
+		}
+		releaseEvent.CurrentReleaseConfigMap = configMap
+		return releaseEvent, nil
+	}
+
+	secret := stored.secret.DeepCopy()
+	secret.Data["release"] = []byte(data)
+	setStatusLabel(secret.Labels, release.Info.Status)
+
+	secrets := client.CoreV1().Secrets(secret.Namespace)
+	if _, err := secrets.Update(secret); err != nil {
+		if _, err := secrets.Create(secret); err != nil {
+			return nil, err
+		}
+	}
+	releaseEvent.CurrentReleaseSecret = secret
+	return releaseEvent, nil
+}
+
+// Helm keeps the status of a release in a label as well as in the release.
+func setStatusLabel(labels map[string]string, status rspb.Status) {
+	if labels != nil {
+		labels["status"] = status.String()
+	}
+}
@@ -0,0 +1,225 @@
+package utils
+
+import (
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Cluster is a Kubernetes cluster which KubeWise watches for Helm releases. KubeWise watches
+// the cluster it runs in unless other clusters are configured with:
+//   - KW_KUBECONFIG_CONTEXTS: a comma separated list of contexts in the kubeconfig file, or *
+//     for every context. The context name is used as the cluster name.
+//   - KW_KUBECONFIG_SECRETS: a comma separated list of Secrets in the KubeWise namespace which
+//     hold a kubeconfig file. The Secret name, minus any -kubeconfig suffix, is used as the
+//     cluster name.
+//
+// KW_CLUSTER_NAME names the cluster which KubeWise runs in. When other clusters are
+// configured, the cluster KubeWise runs in is only watched if it has a name.
+type Cluster struct {
+	// Name is blank when KubeWise watches only the cluster it runs in and it has not been named.
+	Name string
+	// Local is true for the cluster which KubeWise runs in.
+	Local  bool
+	config *rest.Config
+
+	// Clients are created the first time they are needed. The controllers of several clusters
+	// and their workers may ask for them at the same time.
+	clientOnce         sync.Once
+	client             kubernetes.Interface
+	metadataClientOnce sync.Once
+	metadataClient     metadata.Interface
+	dynamicClientOnce  sync.Once
+	dynamicClient      dynamic.Interface
+	restMapperOnce     sync.Once
+	restMapper         *restmapper.DeferredDiscoveryRESTMapper
+}
+
+// GetClient returns a client for the cluster. The same client is shared by every caller.
+func (c *Cluster) GetClient() kubernetes.Interface {
+	c.clientOnce.Do(func() {
+		clientset, err := kubernetes.NewForConfig(c.config)
+		if err != nil {
+			log.Fatalln("Can not create kubernetes client for cluster", c.Name)
+		}
+		c.client = clientset
+	})
+
+	return c.client
+}
+
+// GetMetadataClient returns a client which only fetches the metadata of Kubernetes objects in
+// the cluster.
+func (c *Cluster) GetMetadataClient() metadata.Interface {
+	c.metadataClientOnce.Do(func() {
+		client, err := metadata.NewForConfig(c.config)
+		if err != nil {
+			log.Fatalln("Can not create kubernetes metadata client for cluster", c.Name)
+		}
+		c.metadataClient = client
+	})
+
+	return c.metadataClient
+}
+
+// GetDynamicClient returns a client which can fetch any kind of Kubernetes object in the
+// cluster as unstructured data.
+func (c *Cluster) GetDynamicClient() dynamic.Interface {
+	c.dynamicClientOnce.Do(func() {
+		client, err := dynamic.NewForConfig(c.config)
+		if err != nil {
+			log.Fatalln("Can not create kubernetes dynamic client for cluster", c.Name)
+		}
+		c.dynamicClient = client
+	})
+
+	return c.dynamicClient
+}
+
+// GetRESTMapper returns a mapper from the kinds of Kubernetes objects in the cluster to the
+// resources which serve them. Discovery results are cached. Call Reset on the mapper to pick
+// up CRDs which were installed after it was first used.
+func (c *Cluster) GetRESTMapper() *restmapper.DeferredDiscoveryRESTMapper {
+	c.restMapperOnce.Do(func() {
+		discovery := memory.NewMemCacheClient(c.GetClient().Discovery())
+		c.restMapper = restmapper.NewDeferredDiscoveryRESTMapper(discovery)
+	})
+
+	return c.restMapper
+}
+
+// String describes the cluster in log messages.
+func (c *Cluster) String() string {
+	if c.Name == "" {
+		return "local cluster"
+	}
+	return "cluster " + c.Name
+}
+
+// NewClusterWithClient creates a cluster which uses the given client, e.g. a fake client
+// holding releases which were read from files. Only GetClient can be used with it.
+func NewClusterWithClient(name string, client kubernetes.Interface) *Cluster {
+	cluster := &Cluster{Name: name, client: client}
+	cluster.clientOnce.Do(func() {})
+	return cluster
+}
+
+// GetLocalCluster returns the cluster which KubeWise runs in, or the current context of the
+// kubeconfig file when running outside a cluster.
+func GetLocalCluster() *Cluster {
+	return &Cluster{
+		Name:   os.Getenv("KW_CLUSTER_NAME"),
+		Local:  true,
+		config: GetConfig(),
+	}
+}
+
+// GetClusters returns every cluster which KubeWise should watch. It exits if a configured
+// cluster cannot be loaded, because silently watching fewer clusters than expected would mean
+// missing notifications.
+func GetClusters() []*Cluster {
+	clusters := []*Cluster{}
+
+	if contexts := GetEnvList("KW_KUBECONFIG_CONTEXTS"); len(contexts) > 0 {
+		clusters = append(clusters, getContextClusters(contexts)...)
+	}
+
+	if secrets := GetEnvList("KW_KUBECONFIG_SECRETS"); len(secrets) > 0 {
+		clusters = append(clusters, getSecretClusters(secrets)...)
+	}
+
+	if len(clusters) == 0 || os.Getenv("KW_CLUSTER_NAME") != "" {
+		clusters = append([]*Cluster{GetLocalCluster()}, clusters...)
+	}
+
+	names := make(map[string]bool)
+	for _, cluster := range clusters {
+		if names[cluster.Name] {
+			log.Fatalln("KubeWise is configured to watch more than one cluster named", cluster.Name)
+		}
+		names[cluster.Name] = true
+	}
+
+	return clusters
+}
+
+func getContextClusters(contexts []string) []*Cluster {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+
+	if len(contexts) == 1 && contexts[0] == "*" {
+		rawConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{}).RawConfig()
+		if err != nil {
+			log.Fatalln("Can not read kubeconfig contexts:", err)
+		}
+
+		contexts = []string{}
+		for name := range rawConfig.Contexts {
+			contexts = append(contexts, name)
+		}
+		sort.Strings(contexts)
+	}
+
+	clusters := make([]*Cluster, 0, len(contexts))
+	for _, context := range contexts {
+		config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			loadingRules,
+			&clientcmd.ConfigOverrides{CurrentContext: context},
+		).ClientConfig()
+		if err != nil {
+			log.Fatalln("Can not get kubernetes config for kubeconfig context", context+":", err)
+		}
+
+		clusters = append(clusters, &Cluster{Name: context, config: config})
+	}
+
+	return clusters
+}
+
+// getSecretClusters reads kubeconfig files from Secrets. The kubeconfig is read from the
+// kubeconfig key, or the value key which Cluster API uses, or the only key in the Secret.
+func getSecretClusters(secrets []string) []*Cluster {
+	client := GetClient()
+	namespace := GetPodNamespace()
+
+	clusters := make([]*Cluster, 0, len(secrets))
+	for _, name := range secrets {
+		secret, err := client.CoreV1().Secrets(namespace).Get(name, meta_v1.GetOptions{})
+		if err != nil {
+			log.Fatalln("Can not get kubeconfig Secret", namespace+"/"+name+":", err)
+		}
+
+		kubeconfig, ok := secret.Data["kubeconfig"]
+		if !ok {
+			kubeconfig, ok = secret.Data["value"]
+		}
+		if !ok && len(secret.Data) == 1 {
+			for _, value := range secret.Data {
+				kubeconfig = value
+			}
+		}
+		if len(kubeconfig) == 0 {
+			log.Fatalln("Kubeconfig Secret", namespace+"/"+name, "has no kubeconfig or value key")
+		}
+
+		// Do NOT log the err. It may quote the kubeconfig, which contains credentials.
+		config, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+		if err != nil {
+			log.Fatalln("Can not parse kubeconfig in Secret", namespace+"/"+name)
+		}
+
+		clusters = append(clusters, &Cluster{Name: strings.TrimSuffix(name, "-kubeconfig"), config: config})
+	}
+
+	return clusters
+}
@@ -18,6 +18,8 @@ limitations under the License.
 Modifications made
  1. Deleted superfluous code for getting object MetaData.
  2. Added GetClient function and made others private.
+ 3. Added GetConfig and GetMetadataClient functions.
+ 4. Added Cluster so that clusters other than the one KubeWise runs in can be watched.
 */
 
 package utils
@@ -27,6 +29,7 @@ import (
 	"os"
 
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 
@@ -37,25 +40,38 @@ import (
 
 // GetClient will read the kubectl from within or outside a cluster.
 func GetClient() kubernetes.Interface {
-	_, err := rest.InClusterConfig()
+	clientset, err := kubernetes.NewForConfig(GetConfig())
 	if err != nil {
-		return getClientOutOfCluster()
+		log.Fatalf("Can not create kubernetes client.")
 	}
-	return getClientInsideCluster()
+
+	return clientset
 }
 
-func getClientInsideCluster() kubernetes.Interface {
-	config, err := rest.InClusterConfig()
+// GetMetadataClient returns a client which only fetches the metadata of Kubernetes objects. It
+// is much cheaper to list and watch objects this way when their contents are not needed.
+func GetMetadataClient() metadata.Interface {
+	client, err := metadata.NewForConfig(GetConfig())
 	if err != nil {
-		log.Fatalf("Can not get kubernetes config.")
+		log.Fatalf("Can not create kubernetes metadata client.")
+	}
+
+	return client
+}
+
+// GetConfig will read the kubectl config from within or outside a cluster.
+func GetConfig() *rest.Config {
+	config, err := rest.InClusterConfig()
+	if err == nil {
+		return config
 	}
 
-	clientset, err := kubernetes.NewForConfig(config)
+	config, err = buildOutOfClusterConfig()
 	if err != nil {
-		log.Fatalf("Can not create kubernetes client.")
+		log.Fatalf("Can not get kubernetes config.")
 	}
 
-	return clientset
+	return config
 }
 
 func buildOutOfClusterConfig() (*rest.Config, error) {
@@ -65,17 +81,3 @@ func buildOutOfClusterConfig() (*rest.Config, error) {
 	}
 	return clientcmd.BuildConfigFromFlags("", kubeconfigPath)
 }
-
-func getClientOutOfCluster() kubernetes.Interface {
-	config, err := buildOutOfClusterConfig()
-	if err != nil {
-		log.Fatalf("Can not get kubernetes config.")
-	}
-
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		log.Fatalf("Can not get kubernetes config.")
-	}
-
-	return clientset
-}
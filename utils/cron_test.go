@@ -0,0 +1,197 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// Wednesday 14 October 2026, 10:07:30.
+	from := time.Date(2026, time.October, 14, 10, 7, 30, 0, time.UTC)
+
+	tests := []struct {
+		spec     string
+		expected []time.Time
+	}{
+		{
+			spec: "* * * * *",
+			expected: []time.Time{
+				time.Date(2026, time.October, 14, 10, 8, 0, 0, time.UTC),
+				time.Date(2026, time.October, 14, 10, 9, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "*/15 * * * *",
+			expected: []time.Time{
+				time.Date(2026, time.October, 14, 10, 15, 0, 0, time.UTC),
+				time.Date(2026, time.October, 14, 10, 30, 0, 0, time.UTC),
+			},
+		},
+		{
+			// A step from a single value runs to the end of the field.
+			spec: "5/20 * * * *",
+			expected: []time.Time{
+				time.Date(2026, time.October, 14, 10, 25, 0, 0, time.UTC),
+				time.Date(2026, time.October, 14, 10, 45, 0, 0, time.UTC),
+				time.Date(2026, time.October, 14, 11, 5, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "0 9-17/4 * * *",
+			expected: []time.Time{
+				time.Date(2026, time.October, 14, 13, 0, 0, 0, time.UTC),
+				time.Date(2026, time.October, 14, 17, 0, 0, 0, time.UTC),
+				time.Date(2026, time.October, 15, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "30 8 1,15 * *",
+			expected: []time.Time{
+				time.Date(2026, time.October, 15, 8, 30, 0, 0, time.UTC),
+				time.Date(2026, time.November, 1, 8, 30, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "0 9 * * 1",
+			expected: []time.Time{
+				time.Date(2026, time.October, 19, 9, 0, 0, 0, time.UTC),
+				time.Date(2026, time.October, 26, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "0 9 * * 1-5",
+			expected: []time.Time{
+				time.Date(2026, time.October, 15, 9, 0, 0, 0, time.UTC),
+				time.Date(2026, time.October, 16, 9, 0, 0, 0, time.UTC),
+				time.Date(2026, time.October, 19, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			// Both 0 and 7 mean Sunday.
+			spec: "0 0 * * 7",
+			expected: []time.Time{
+				time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "0 0 * * 0",
+			expected: []time.Time{
+				time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			// When both day fields are restricted, either may match.
+			spec: "0 0 13 * 5",
+			expected: []time.Time{
+				time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC),
+				time.Date(2026, time.October, 23, 0, 0, 0, 0, time.UTC),
+				time.Date(2026, time.October, 30, 0, 0, 0, 0, time.UTC),
+				time.Date(2026, time.November, 6, 0, 0, 0, 0, time.UTC),
+				time.Date(2026, time.November, 13, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			// A day field which starts with * is not restricted, so both fields must match. This
+			// is Mondays which fall on an odd day of the month.
+			spec: "0 9 */2 * 1",
+			expected: []time.Time{
+				time.Date(2026, time.October, 19, 9, 0, 0, 0, time.UTC),
+				time.Date(2026, time.November, 9, 9, 0, 0, 0, time.UTC),
+				time.Date(2026, time.November, 23, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "0 0 1 1,7 *",
+			expected: []time.Time{
+				time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2027, time.July, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "0 0 29 2 *",
+			expected: []time.Time{
+				time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "@daily",
+			expected: []time.Time{
+				time.Date(2026, time.October, 15, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "@Hourly",
+			expected: []time.Time{
+				time.Date(2026, time.October, 14, 11, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "@weekly",
+			expected: []time.Time{
+				time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "@monthly",
+			expected: []time.Time{
+				time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "@yearly",
+			expected: []time.Time{
+				time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			schedule, err := ParseSchedule(test.spec)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			next := from
+			for _, expected := range test.expected {
+				next = schedule.Next(next)
+				if !next.Equal(expected) {
+					t.Fatalf("expected %s, got %s", expected, next)
+				}
+			}
+		})
+	}
+}
+
+func TestParseScheduleRejectsInvalidSchedules(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"@sometimes",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"-1 * * * *",
+		"5-1 * * * *",
+		"1- * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"1,,2 * * * *",
+		// The 31st of February never comes.
+		"0 0 31 2 *",
+	}
+
+	for _, spec := range tests {
+		t.Run(spec, func(t *testing.T) {
+			if _, err := ParseSchedule(spec); err == nil {
+				t.Errorf("expected %q to be rejected", spec)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GetEnvBool reads a boolean from an environment variable. The fallback is returned when the
+// variable is unset, empty or invalid.
+func GetEnvBool(name string, fallback bool) bool {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Println("Invalid value passed for environment variable", name+". Boolean required.")
+		return fallback
+	}
+
+	return parsed
+}
+
+// GetEnvInt reads an integer from an environment variable. The fallback is returned when the
+// variable is unset, empty or invalid.
+func GetEnvInt(name string, fallback int) int {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Println("Invalid value passed for environment variable", name+". Integer required.")
+		return fallback
+	}
+
+	return parsed
+}
+
+// GetEnvDuration reads a duration such as "30s" or "5m" from an environment variable. The
+// fallback is returned when the variable is unset, empty or invalid.
+func GetEnvDuration(name string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return fallback
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Println("Invalid value passed for environment variable", name+". Duration required, e.g. 30s.")
+		return fallback
+	}
+
+	return parsed
+}
+
+// GetEnvList reads a comma separated list from an environment variable. Whitespace around
+// each item is trimmed and empty items are dropped.
+func GetEnvList(name string) []string {
+	items := []string{}
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// The namespace a pod is running in is mounted alongside its service account token.
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// GetPodNamespace returns the namespace that KubeWise itself is running in. This is where
+// KubeWise keeps any objects it creates for its own bookkeeping. It is not necessarily the
+// namespace being watched for Helm operations. Outside a cluster, set KW_POD_NAMESPACE.
+func GetPodNamespace() string {
+	if value, ok := os.LookupEnv("KW_POD_NAMESPACE"); ok && value != "" {
+		return value
+	}
+
+	if data, err := ioutil.ReadFile(serviceAccountNamespaceFile); err == nil {
+		if namespace := strings.TrimSpace(string(data)); namespace != "" {
+			return namespace
+		}
+	}
+
+	return "default"
+}